@@ -0,0 +1,219 @@
+package bedrockjsonfix
+
+import (
+	"context"
+	"iter"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// BatchResult is the outcome of one FixBatch input.
+type BatchResult struct {
+	// Index is the position of the input in the sequence.
+	Index  int
+	Name   string
+	Result Result
+	Err    error
+}
+
+// FileError is a failed FixBatch input.
+type FileError struct {
+	Index int
+	Name  string
+	Err   error
+}
+
+func (e *FileError) Error() string { return e.Name + ": " + e.Err.Error() }
+func (e *FileError) Unwrap() error { return e.Err }
+
+// BatchReport aggregates the inputs a batch processed.
+type BatchReport struct {
+	// Files counts processed inputs and Failed the ones that returned an error.
+	Files  int
+	Failed int
+	// Report sums the counters of the inputs that were fixed. Flags and
+	// Repairs are set when any input set them; Risk is the highest risk.
+	// The stage, rule and transport lists are merged in input order, and
+	// CodeWrapper joins the distinct wrappers with commas. Markdown, a span
+	// of a single input, is the span of the first input that had one.
+	Report Report
+	// Errors lists failed inputs in input order.
+	Errors []FileError
+}
+
+// Batch is a FixBatch run. Range over Results, then call Wait. A Batch is
+// not safe for concurrent use.
+type Batch struct {
+	ctx     context.Context
+	inputs  iter.Seq2[string, []byte]
+	fixer   *Fixer
+	workers int
+
+	once sync.Once
+	rep  BatchReport
+	err  error
+}
+
+type batchJob struct {
+	index int
+	name  string
+	input []byte
+	done  chan BatchResult
+}
+
+// FixBatch fixes named inputs on a pool of workers, or GOMAXPROCS workers
+// when workers is not positive. Nothing runs until Results or Wait is
+// called. Results arrive in input order while later inputs are still being
+// fixed. Failed inputs are recorded and the batch continues, unless
+// opt.BatchFailFast is set.
+func FixBatch(ctx context.Context, inputs iter.Seq2[string, []byte], opt Options, workers int) (*Batch, error) {
+	f, err := NewFixer(opt)
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &Batch{ctx: ctx, inputs: inputs, fixer: f, workers: workers}, nil
+}
+
+// Results runs the batch and yields each result in input order. It can be
+// ranged once; breaking out of the loop stops the remaining work.
+func (b *Batch) Results() iter.Seq[BatchResult] {
+	return func(yield func(BatchResult) bool) {
+		b.once.Do(func() { b.run(yield) })
+	}
+}
+
+// Wait runs the batch if Results was not ranged and returns the aggregate
+// report. The error is ErrContextCanceled when ctx ended the batch early,
+// or the *FileError that stopped a fail-fast batch.
+func (b *Batch) Wait() (BatchReport, error) {
+	b.once.Do(func() { b.run(func(BatchResult) bool { return true }) })
+	return b.rep, b.err
+}
+
+func (b *Batch) run(yield func(BatchResult) bool) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(b.ctx)
+	defer cancel()
+
+	jobs := make(chan *batchJob)
+	order := make(chan *batchJob, b.workers)
+	wg.Add(1 + b.workers)
+	go func() {
+		defer wg.Done()
+		defer close(order)
+		defer close(jobs)
+		i := 0
+		for name, input := range b.inputs {
+			j := &batchJob{index: i, name: name, input: input, done: make(chan BatchResult, 1)}
+			i++
+			select {
+			case order <- j:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for range b.workers {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := BatchResult{Index: j.index, Name: j.name}
+				_, r.Result, r.Err = b.fixer.FixContext(ctx, nil, j.input)
+				j.done <- r
+			}
+		}()
+	}
+	for j := range order {
+		if b.ctx.Err() != nil {
+			break
+		}
+		var r BatchResult
+		select {
+		case r = <-j.done:
+		case <-ctx.Done():
+			continue
+		}
+		b.add(r)
+		if !yield(r) {
+			return
+		}
+		if r.Err != nil && b.fixer.opt.BatchFailFast {
+			fe := b.rep.Errors[len(b.rep.Errors)-1]
+			b.err = &fe
+			return
+		}
+	}
+	if b.ctx.Err() != nil {
+		b.err = contextCanceledError()
+	}
+}
+
+func (b *Batch) add(r BatchResult) {
+	b.rep.Files++
+	if r.Err != nil {
+		b.rep.Failed++
+		b.rep.Errors = append(b.rep.Errors, FileError{Index: r.Index, Name: r.Name, Err: r.Err})
+		return
+	}
+	addReport(&b.rep.Report, r.Result.Report)
+}
+
+// addReport adds the counters of src to dst.
+func addReport(dst *Report, src Report) {
+	dst.InputWasInvalidUTF8 = dst.InputWasInvalidUTF8 || src.InputWasInvalidUTF8
+	dst.UsedCP1252Fallback = dst.UsedCP1252Fallback || src.UsedCP1252Fallback
+	dst.RemovedBOM += src.RemovedBOM
+	dst.ReplacedNBSP += src.ReplacedNBSP
+	dst.ReplacedNBSPInStrings += src.ReplacedNBSPInStrings
+	dst.RemovedZeroWidth += src.RemovedZeroWidth
+	dst.RemovedZeroWidthInStrings += src.RemovedZeroWidthInStrings
+	dst.RemovedASCIIControls += src.RemovedASCIIControls
+	dst.NormalizedCRLF += src.NormalizedCRLF
+	dst.EscapedStringControls += src.EscapedStringControls
+	dst.NormalizedNewlinesInStrings += src.NormalizedNewlinesInStrings
+	dst.StrippedLineComments += src.StrippedLineComments
+	dst.StrippedBlockComments += src.StrippedBlockComments
+	dst.RemovedTrailingCommas += src.RemovedTrailingCommas
+	dst.DroppedJunkOutsideStrings += src.DroppedJunkOutsideStrings
+	dst.TrimmedLeadingJunkBytes += src.TrimmedLeadingJunkBytes
+	dst.TrimmedTrailingJunkBytes += src.TrimmedTrailingJunkBytes
+	dst.RootScanUsed = dst.RootScanUsed || src.RootScanUsed
+	dst.RootScanAttemptsUsed += src.RootScanAttemptsUsed
+	dst.ValidJSON = dst.ValidJSON || src.ValidJSON
+	dst.Repairs |= src.Repairs
+	dst.Risk = max(dst.Risk, src.Risk)
+	for _, st := range src.Stages() {
+		addStageCount(dst, st.Name, st.Changes)
+	}
+	for _, h := range src.Rules() {
+		addRuleHit(dst, h.ID, h.Hits)
+	}
+	dst.KeptComments += src.KeptComments
+	if w := src.CodeWrapper; w != "" && !slices.Contains(strings.Split(dst.CodeWrapper, ","), w) {
+		if dst.CodeWrapper != "" {
+			dst.CodeWrapper += ","
+		}
+		dst.CodeWrapper += w
+	}
+	for _, enc := range src.Transport() {
+		if !slices.Contains(dst.Transport(), enc) {
+			l := dst.editLists()
+			l.transport = append(l.transport, enc)
+		}
+	}
+	dst.UnwrappedStringLayers += src.UnwrappedStringLayers
+	if dst.Markdown == (Span{}) {
+		dst.Markdown = src.Markdown
+	}
+}
@@ -0,0 +1,173 @@
+package bedrockjsonfix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"testing"
+)
+
+func batchInputs(n int, bad func(int) bool) iter.Seq2[string, []byte] {
+	return func(yield func(string, []byte) bool) {
+		for i := range n {
+			input := fmt.Sprintf("// file %d\n{\"i\": %d,}", i, i)
+			if bad(i) {
+				input = `{"i": ` + "\n"
+			}
+			if !yield(fmt.Sprintf("f%03d.json", i), []byte(input)) {
+				return
+			}
+		}
+	}
+}
+
+func TestFixBatchOrderedResultsAndReport(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty = false
+	b, err := FixBatch(t.Context(), batchInputs(100, func(i int) bool { return i%10 == 3 }), opt, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := 0
+	for r := range b.Results() {
+		if r.Index != next || r.Name != fmt.Sprintf("f%03d.json", next) {
+			t.Fatalf("result %d out of order: %d %s", next, r.Index, r.Name)
+		}
+		if next%10 == 3 {
+			if !errors.Is(r.Err, ErrInvalidJSON) {
+				t.Fatalf("expected ErrInvalidJSON for %s, got %v", r.Name, r.Err)
+			}
+		} else if want := fmt.Sprintf("{\"i\":%d}\n", next); r.Err != nil || string(r.Result.Output) != want {
+			t.Fatalf("%s = %q, %v; want %q", r.Name, r.Result.Output, r.Err, want)
+		}
+		next++
+	}
+	rep, err := b.Wait()
+	if err != nil {
+		t.Fatalf("continue-on-error batch returned %v", err)
+	}
+	if next != 100 || rep.Files != 100 || rep.Failed != 10 || len(rep.Errors) != 10 {
+		t.Fatalf("unexpected totals: yielded %d, report %+v", next, rep)
+	}
+	if rep.Errors[0].Index != 3 || rep.Errors[9].Name != "f093.json" {
+		t.Fatalf("unexpected error list %+v", rep.Errors)
+	}
+	if rep.Report.StrippedLineComments != 90 || rep.Report.RemovedTrailingCommas != 90 || rep.Report.Repairs&RepairLineComments == 0 {
+		t.Fatalf("unexpected aggregate report %+v", rep.Report)
+	}
+}
+
+func TestFixBatchFailFast(t *testing.T) {
+	opt := DefaultOptions()
+	opt.BatchFailFast = true
+	b, err := FixBatch(t.Context(), batchInputs(1000, func(i int) bool { return i == 5 }), opt, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep, err := b.Wait()
+	var fe *FileError
+	if !errors.As(err, &fe) || fe.Index != 5 || !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("expected FileError for input 5, got %v", err)
+	}
+	if rep.Files != 6 || rep.Failed != 1 {
+		t.Fatalf("expected batch to stop after input 5, got %+v", rep)
+	}
+}
+
+func TestFixBatchCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	b, err := FixBatch(ctx, batchInputs(1000, func(int) bool { return false }), DefaultOptions(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range b.Results() {
+		if n++; n == 10 {
+			cancel()
+		}
+	}
+	rep, err := b.Wait()
+	if !errors.Is(err, ErrContextCanceled) {
+		t.Fatalf("expected ErrContextCanceled, got %v", err)
+	}
+	if rep.Files != n || n >= 1000 {
+		t.Fatalf("expected early stop, got %d results and %+v", n, rep)
+	}
+}
+
+func TestFixBatchBreakStopsWork(t *testing.T) {
+	b, err := FixBatch(t.Context(), batchInputs(1000, func(int) bool { return false }), DefaultOptions(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := range b.Results() {
+		if r.Index == 2 {
+			break
+		}
+	}
+	rep, err := b.Wait()
+	if err != nil || rep.Files != 3 {
+		t.Fatalf("expected 3 files and no error, got %+v, %v", rep, err)
+	}
+}
+
+func TestFixBatchValidatesOptions(t *testing.T) {
+	opt := DefaultOptions()
+	opt.MaxOutputBytes = 0
+	if _, err := FixBatch(t.Context(), batchInputs(1, func(int) bool { return false }), opt, 1); !errors.Is(err, ErrOptionsInvalid) {
+		t.Fatalf("expected ErrOptionsInvalid, got %v", err)
+	}
+}
+
+// TestAddReportCoversEveryField fails when a Report field is added without
+// aggregating it in addReport.
+func TestAddReportCoversEveryField(t *testing.T) {
+	var src Report
+	v := reflect.ValueOf(&src).Elem()
+	for i := range v.NumField() {
+		if f := v.Field(i); f.CanSet() {
+			setNonZero(f)
+		}
+	}
+	l := src.editLists()
+	l.stages = []StageCount{{Name: "s", Changes: 1}}
+	l.rules = []RuleHit{{ID: "r", Hits: 1}}
+	l.transport = []string{TransportGzip}
+
+	var dst Report
+	addReport(&dst, src)
+	got := reflect.ValueOf(dst)
+	for i := range got.NumField() {
+		if f := got.Field(i); f.IsZero() {
+			t.Errorf("addReport does not aggregate Report.%s", got.Type().Field(i).Name)
+		}
+	}
+	lists := reflect.ValueOf(*dst.lists)
+	for i := range lists.NumField() {
+		if lists.Field(i).IsZero() {
+			t.Errorf("addReport does not aggregate the %s list", lists.Type().Field(i).Name)
+		}
+	}
+}
+
+func setNonZero(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint32:
+		v.SetUint(1)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Struct:
+		for i := range v.NumField() {
+			setNonZero(v.Field(i))
+		}
+	default:
+		panic("setNonZero: unsupported kind " + v.Kind().String())
+	}
+}
@@ -1,6 +1,10 @@
 package bedrockjsonfix
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
 	"strings"
 	"testing"
 )
@@ -53,3 +57,145 @@ func BenchmarkFixBytesTolerantCommentsAndCommas(b *testing.B) {
 		benchmarkResult = res
 	}
 }
+
+var benchmarkDiagnostics Diagnostics
+
+func BenchmarkLintTolerantCommentsAndCommas(b *testing.B) {
+	input := []byte(`{// line
+"items":[` + strings.Repeat(`{"name":"stone",/* block */"value":1,},`, 1024) + `]}`)
+	opt := DefaultOptions()
+	opt.Pretty = false
+	opt.PreserveIfValid = false
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		d, err := Lint(input, opt)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkDiagnostics = d
+	}
+}
+
+func benchmarkResourcePackInput(entries int) []byte {
+	var b strings.Builder
+	b.WriteString("\xEF\xBB\xBF// generated pack\r\n{\r\n  \"format_version\": \"1.20.0\",\r\n  \"entries\": [\r\n")
+	for i := 0; i < entries; i++ {
+		b.WriteString("    { // entry\r\n      \"name\": \"minecraft:stone\", /* id */\r\n      \"texture\": \"textures/blocks/stone\",\r\n      \"values\": [1, 2.5, -3e2, true, null,],\r\n    },\r\n")
+	}
+	b.WriteString("  ],\r\n}\r\n")
+	return []byte(b.String())
+}
+
+func BenchmarkFixBytesResourcePack(b *testing.B) {
+	input := benchmarkResourcePackInput(8192)
+	opt := DefaultOptions()
+	opt.Pretty = false
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		res, err := FixBytes(input, opt)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkResult = res
+	}
+}
+
+func BenchmarkFixerResourcePack(b *testing.B) {
+	input := benchmarkResourcePackInput(8192)
+	opt := DefaultOptions()
+	opt.Pretty = false
+	f, err := NewFixer(opt)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+
+	var dst []byte
+	for i := 0; i < b.N; i++ {
+		var res Result
+		dst, res, err = f.Fix(dst[:0], input)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkResult = res
+	}
+}
+
+func BenchmarkCleanupResourcePack(b *testing.B) {
+	input := benchmarkResourcePackInput(8192)
+	opt := DefaultOptions()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var rep Report
+		cl, _ := cleanup(context.Background(), input, opt, &rep, nil, nil)
+		benchmarkResult.Output = cl.out
+	}
+}
+
+func BenchmarkFixStreamResourcePack(b *testing.B) {
+	input := benchmarkResourcePackInput(8192)
+	opt := DefaultStreamOptions()
+	opt.Pretty = false
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		res, err := FixStream(context.Background(), bytes.NewReader(input), io.Discard, opt)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkResult = res
+	}
+}
+
+// benchmarkStrictPack is the resource pack after cleanup: the input of the
+// parse and emit stage.
+func benchmarkStrictPack(b *testing.B) []byte {
+	res, err := FixBytes(benchmarkResourcePackInput(8192), DefaultOptions())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return res.Output
+}
+
+func BenchmarkEmitDocument(b *testing.B) {
+	input := benchmarkStrictPack(b)
+	opt := DefaultOptions()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		out, _, err := emitDocument(context.Background(), nil, input, opt, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkResult.Output = out
+	}
+}
+
+// BenchmarkDecodeAndMarshalIndent is the tree round trip emitDocument replaced.
+func BenchmarkDecodeAndMarshalIndent(b *testing.B) {
+	input := benchmarkStrictPack(b)
+	opt := DefaultOptions()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v, err := decodeTree(input)
+		if err != nil {
+			b.Fatal(err)
+		}
+		out, err := json.MarshalIndent(v, opt.Prefix, opt.Indent)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchmarkResult.Output = out
+	}
+}
@@ -0,0 +1,420 @@
+package bedrockjsonfix
+
+import (
+	"context"
+	"unicode/utf8"
+)
+
+// cleaned is the result of the single tolerant cleanup pass.
+type cleaned struct {
+	out []byte
+	// rootStart is the offset in out of the first '{' or '[' outside strings,
+	// or -1 when there is none.
+	rootStart int
+	// rootEnd is the end of the first balanced root in out, or -1 when the
+	// root is incomplete or its delimiters do not match.
+	rootEnd  int
+	rootKind RootKind
+}
+
+// cleaner rewrites tolerant input token by token. Output is only allocated
+// once the first repair changes a byte; until then it is input[base:pos].
+type cleaner struct {
+	in     []byte
+	base   int
+	out    []byte
+	copied bool
+	fixes  Repair
+	rep    Report
+	m      *offsetMap
+
+	dropping bool
+	root     int
+
+	// notes collects comments for OutputJSONC. sawToken and sawNewline
+	// track whether a comment shares a line with the token before it.
+	notes      *[]keptComment
+	sawToken   bool
+	sawNewline bool
+
+	// lint records each repair for Lint, in input offsets.
+	lint *lintLog
+
+	stack []byte
+	res   cleaned
+}
+
+// Progress of the first root value through the cleanup pass.
+const (
+	rootPending = iota
+	rootOpen
+	rootClosed
+)
+
+// cleanup applies every enabled byte-level repair in one pass over input:
+// BOM, CRLF, invisible whitespace and control removal, comment stripping,
+// string escaping, trailing comma removal and junk dropping. It also locates
+// the first root value so the caller does not rescan the buffer. When sc is
+// set, the output is built in its clean buffer. The only error is a
+// cancellation of ctx, which is polled every cancelCheckBytes.
+func cleanup(ctx context.Context, input []byte, opt Options, rep *Report, m *offsetMap, sc *fixScratch) (cleaned, error) {
+	return cleanupPass(ctx, input, opt, false, rep, m, sc)
+}
+
+// sanitizeRepairs are the repairs of the sanitize part of cleanup. The
+// strip_comments part applies the others.
+const sanitizeRepairs = RepairBOM | RepairCRLF | RepairNBSP | RepairZeroWidth | RepairASCIIControls |
+	RepairStringControls | RepairStringNewlines | RepairStringWhitespace
+
+// sanitize applies only the sanitizeRepairs of cleanup, for stages placed
+// between StageSanitize and StageStripComments; cleanup then runs on its
+// output. Comments are lexed as cleanup lexes them, but kept. The output
+// does not alias the buffers of sc.
+func sanitize(ctx context.Context, input []byte, opt Options, rep *Report, m *offsetMap, sc *fixScratch) ([]byte, error) {
+	var own fixScratch
+	if sc != nil {
+		own.lint = sc.lint
+	}
+	cl, err := cleanupPass(ctx, input, opt, true, rep, m, &own)
+	return cl.out, err
+}
+
+func cleanupPass(ctx context.Context, input []byte, opt Options, sanitizeOnly bool, rep *Report, m *offsetMap, sc *fixScratch) (cleaned, error) {
+	fixes := opt.effectiveFixes()
+	comments := fixes&(RepairLineComments|RepairBlockComments) != 0 || (opt.Output == OutputJSONC && sc != nil)
+	if sanitizeOnly {
+		fixes &= sanitizeRepairs
+	}
+	// The counters are copied in and out so the cleaner, whose buffers
+	// escape, does not drag the caller's Report onto the heap.
+	c := cleaner{in: input, fixes: fixes, rep: *rep, m: m}
+	if sc != nil {
+		c.out, c.stack, c.lint = sc.clean[:0], sc.stack[:0], sc.lint
+	}
+	c.res.rootStart, c.res.rootEnd = -1, -1
+	c.dropping = c.fixes&RepairDropJunk != 0 && c.fixes&RepairLeadingJunk == 0
+	if c.fixes&RepairBOM != 0 && len(input) >= 3 && input[0] == 0xEF && input[1] == 0xBB && input[2] == 0xBF {
+		c.base = 3
+		c.rep.RemovedBOM++
+		c.lint.add(lintBOM, 0, 3)
+		m.mark(0, 3)
+	}
+	if opt.Output == OutputJSONC && sc != nil && !sanitizeOnly {
+		c.notes = &sc.jsonc.list
+	}
+	lx := newTolerantLexer(input, c.base, comments)
+	nextCheck := cancelCheckBytes
+	for {
+		t := lx.next()
+		if t.kind == tokEOF {
+			break
+		}
+		c.token(t, lx)
+		if t.end >= nextCheck {
+			if ctx.Err() != nil {
+				return cleaned{}, contextCanceledError()
+			}
+			nextCheck = t.end + cancelCheckBytes
+		}
+	}
+	if c.copied {
+		c.res.out = c.out
+	} else {
+		c.res.out = input[c.base:]
+	}
+	if sc != nil {
+		sc.clean, sc.stack = c.out[:0], c.stack[:0]
+	}
+	*rep = c.rep
+	return c.res, nil
+}
+
+func (c *cleaner) token(t lexToken, lx tolerantLexer) {
+	if c.notes != nil {
+		c.track(t)
+	}
+	switch t.kind {
+	case tokWhitespace:
+		if t.flags == 0 {
+			c.keep(t.start, t.end)
+			return
+		}
+		c.whitespace(t)
+	case tokLineComment:
+		switch {
+		case c.notes != nil:
+			c.noteComment(t)
+		case c.fixes&RepairLineComments == 0:
+			c.keep(t.start, t.end)
+			return
+		default:
+			c.rep.StrippedLineComments++
+			c.lint.add(lintLineComment, t.start, t.end)
+		}
+		c.drop(t.start, t.end)
+	case tokBlockComment:
+		switch {
+		case c.notes != nil:
+			c.noteComment(t)
+		case c.fixes&RepairBlockComments == 0:
+			c.keep(t.start, t.end)
+			return
+		default:
+			c.rep.StrippedBlockComments++
+			c.lint.add(lintBlockComment, t.start, t.end)
+		}
+		c.edit(t.start)
+		if len(c.out) == 0 || c.out[len(c.out)-1] != ' ' {
+			c.out = append(c.out, ' ')
+		}
+		c.m.mark(len(c.out), t.end)
+	case tokString:
+		if t.flags&(flagNewline|flagControl|flagNBSP|flagZeroWidth) == 0 {
+			c.keep(t.start, t.end)
+			return
+		}
+		c.string(t)
+	case tokPunct:
+		c.punct(t, lx)
+	case tokJunk:
+		if !c.dropping {
+			c.keep(t.start, t.end)
+			return
+		}
+		c.rep.DroppedJunkOutsideStrings += t.end - t.start
+		c.lint.add(lintJunk, t.start, t.end)
+		c.edit(t.start)
+		if len(c.out) == 0 || c.out[len(c.out)-1] != ' ' {
+			c.out = append(c.out, ' ')
+		}
+		c.m.mark(len(c.out), t.end)
+	default:
+		c.keep(t.start, t.end)
+	}
+}
+
+func (c *cleaner) punct(t lexToken, lx tolerantLexer) {
+	b := c.in[t.start]
+	switch b {
+	case ',':
+		if c.fixes&RepairTrailingCommas != 0 && c.closesNext(lx) {
+			c.rep.RemovedTrailingCommas++
+			c.lint.add(lintTrailingComma, t.start, t.end)
+			c.drop(t.start, t.end)
+			return
+		}
+	case '{', '[':
+		switch c.root {
+		case rootPending:
+			c.root = rootOpen
+			c.res.rootStart = c.outLen(t.start)
+			c.res.rootKind = RootArray
+			if b == '{' {
+				c.res.rootKind = RootObject
+			}
+			if c.fixes&RepairDropJunk != 0 {
+				c.dropping = true
+			}
+			c.stack = append(c.stack, b)
+		case rootOpen:
+			c.stack = append(c.stack, b)
+		}
+	case '}', ']':
+		if c.root != rootOpen {
+			break
+		}
+		open := byte('{')
+		if b == ']' {
+			open = '['
+		}
+		if c.stack[len(c.stack)-1] != open {
+			c.root = rootClosed
+			break
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+		if len(c.stack) == 0 {
+			c.root = rootClosed
+			c.res.rootEnd = c.outLen(t.start) + 1
+		}
+	}
+	c.keep(t.start, t.end)
+}
+
+// closesNext reports whether the next significant token after a comma closes
+// an object or array. Comments only count as insignificant when they are
+// being stripped.
+func (c *cleaner) closesNext(lx tolerantLexer) bool {
+	j := lx.pos
+	for j < len(c.in) && (c.in[j] == ' ' || c.in[j] == '\t' || c.in[j] == '\n') {
+		j++
+	}
+	if j < len(c.in) {
+		switch b := c.in[j]; {
+		case b == '}' || b == ']':
+			return true
+		case b != '/' && b >= 0x20 && b < utf8.RuneSelf:
+			return false
+		}
+	}
+	for {
+		t := lx.next()
+		if commaTrivia(t, c.fixes) {
+			continue
+		}
+		if t.kind == tokPunct {
+			b := c.in[t.start]
+			return b == '}' || b == ']'
+		}
+		return false
+	}
+}
+
+// commaTrivia reports whether t may come between a trailing comma and the
+// bracket after it: whitespace, or a comment that is being stripped.
+// FixStream decides trailing commas by the same rule.
+func commaTrivia(t lexToken, fixes Repair) bool {
+	switch t.kind {
+	case tokWhitespace:
+		return true
+	case tokLineComment:
+		return fixes&RepairLineComments != 0
+	case tokBlockComment:
+		return fixes&RepairBlockComments != 0
+	}
+	return false
+}
+
+func (c *cleaner) whitespace(t lexToken) {
+	in := c.in
+	for i := t.start; i < t.end; {
+		b := in[i]
+		switch {
+		case b == '\r' && c.fixes&RepairCRLF != 0:
+			c.rep.NormalizedCRLF++
+			c.edit(i)
+			c.out = append(c.out, '\n')
+			i++
+			if i < t.end && in[i] == '\n' {
+				i++
+			}
+			c.m.mark(len(c.out), i)
+		case b < 0x20 && b != '\n' && b != '\t' && b != '\r' && c.fixes&RepairASCIIControls != 0:
+			c.rep.RemovedASCIIControls++
+			c.lint.add(lintControlChar, i, i+1)
+			c.drop(i, i+1)
+			i++
+		case b == 0xC2 && c.fixes&RepairNBSP != 0:
+			c.rep.ReplacedNBSP++
+			c.lint.add(lintNBSP, i, i+2)
+			c.edit(i)
+			c.out = append(c.out, ' ')
+			i += 2
+			c.m.mark(len(c.out), i)
+		case b == 0xE2 && c.fixes&RepairZeroWidth != 0:
+			c.rep.RemovedZeroWidth++
+			c.lint.add(lintZeroWidth, i, i+3)
+			c.drop(i, i+3)
+			i += 3
+		default:
+			n := whitespaceWidth(b)
+			c.keep(i, i+n)
+			i += n
+		}
+	}
+}
+
+func (c *cleaner) string(t lexToken) {
+	in := c.in
+	esc := false
+	for i := t.start; i < t.end; {
+		b := in[i]
+		if esc {
+			esc = false
+			c.keep(i, i+1)
+			i++
+			continue
+		}
+		switch {
+		case b == '\\':
+			esc = true
+		case b == '\n' && c.fixes&RepairStringNewlines != 0:
+			c.rep.NormalizedNewlinesInStrings++
+			c.lint.add(lintStringNewline, i, i+1)
+			c.edit(i)
+			c.out = append(c.out, '\\', 'n')
+			i++
+			c.m.mark(len(c.out), i)
+			continue
+		case b < 0x20 && b != '\n' && c.fixes&RepairStringControls != 0:
+			c.rep.EscapedStringControls++
+			c.lint.add(lintStringControl, i, i+1)
+			c.edit(i)
+			c.out = appendEscapedControl(c.out, b)
+			i++
+			c.m.mark(len(c.out), i)
+			continue
+		case b == 0xC2 && i+1 < t.end && in[i+1] == 0xA0 && c.fixes&RepairStringWhitespace != 0:
+			c.rep.ReplacedNBSP++
+			c.rep.ReplacedNBSPInStrings++
+			c.lint.add(lintStringNBSP, i, i+2)
+			c.edit(i)
+			c.out = append(c.out, ' ')
+			i += 2
+			c.m.mark(len(c.out), i)
+			continue
+		case b == 0xE2 && isZeroWidthAt(in[:t.end], i) && c.fixes&RepairStringWhitespace != 0:
+			c.rep.RemovedZeroWidth++
+			c.rep.RemovedZeroWidthInStrings++
+			c.lint.add(lintStringZeroWidth, i, i+3)
+			c.drop(i, i+3)
+			i += 3
+			continue
+		}
+		n := 1
+		if b >= utf8.RuneSelf {
+			_, n = utf8.DecodeRune(in[i:t.end])
+		}
+		c.keep(i, i+n)
+		i += n
+	}
+}
+
+// edit switches to a private output buffer holding everything before i.
+func (c *cleaner) edit(i int) {
+	if !c.copied {
+		if n := len(c.in) - c.base + 16; cap(c.out) < n {
+			c.out = make([]byte, 0, n)
+		}
+		c.out = append(c.out[:0], c.in[c.base:i]...)
+		c.copied = true
+	}
+}
+
+func (c *cleaner) keep(i, j int) {
+	if c.copied {
+		c.out = append(c.out, c.in[i:j]...)
+	}
+}
+
+func (c *cleaner) drop(i, j int) {
+	c.edit(i)
+	c.m.mark(len(c.out), j)
+}
+
+// outLen returns the output length before input offset i.
+func (c *cleaner) outLen(i int) int {
+	if c.copied {
+		return len(c.out)
+	}
+	return i - c.base
+}
+
+func appendEscapedControl(dst []byte, c byte) []byte {
+	switch c {
+	case '\r':
+		return append(dst, '\\', 'r')
+	case '\t':
+		return append(dst, '\\', 't')
+	}
+	return append(dst, '\\', 'u', '0', '0', hexUpper[c>>4], hexUpper[c&0x0F])
+}
@@ -0,0 +1,157 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Code wrappers reported in Report.CodeWrapper.
+const (
+	// WrapperAssignment is `const x = {...};`, also with let, var, export
+	// const or a TypeScript type annotation.
+	WrapperAssignment = "assignment"
+	// WrapperModuleExports is `module.exports = {...};`.
+	WrapperModuleExports = "module.exports"
+	// WrapperExportDefault is `export default {...};`.
+	WrapperExportDefault = "export default"
+	// WrapperJSONP is a JSONP callback such as `callback({...});`.
+	WrapperJSONP = "jsonp"
+)
+
+// unwrapCode recognizes a JavaScript wrapper around an object or array
+// literal for RepairCodeWrapper and returns the literal alone with the name
+// of the wrapper. Code after the wrapper's statement, such as a second
+// statement, is dropped with it. in is returned unchanged, with an empty
+// name, when it does not start with a known wrapper. bom reports that in
+// starts with a byte order mark, which is skipped and dropped too.
+func unwrapCode(in []byte, bom bool, trace *offsetTrace) ([]byte, string) {
+	s := codeScanner{in: in}
+	if bom {
+		s.pos = 3
+	}
+	wrapper := s.prefix()
+	if wrapper == "" || s.pos == len(in) || (in[s.pos] != '{' && in[s.pos] != '[') {
+		return in, ""
+	}
+	start := s.pos
+	_, n, _ := locateRoot(in[start:])
+	if n < 0 {
+		return in, ""
+	}
+	end := start + n
+	s.pos = end
+	if wrapper == WrapperJSONP && !s.punct(')') {
+		return in, ""
+	}
+	stmtEnd := s.pos
+	s.space()
+	if s.pos < len(in) && in[s.pos] != ';' && bytes.IndexByte(in[stmtEnd:s.pos], '\n') < 0 {
+		// More of the same statement, such as `= {...} || other`.
+		return in, ""
+	}
+	trace.shift(start)
+	return in[start:end], wrapper
+}
+
+// codeScanner matches the few JavaScript tokens of a wrapper.
+type codeScanner struct {
+	in  []byte
+	pos int
+}
+
+// prefix matches the wrapper before the literal and returns its name, with
+// pos at the literal.
+func (s *codeScanner) prefix() string {
+	switch w := s.path(); w {
+	case "export":
+		switch s.path() {
+		case "default":
+			s.space()
+			return WrapperExportDefault
+		case "const", "let", "var":
+			return s.assignment()
+		}
+	case "const", "let", "var":
+		return s.assignment()
+	case "module.exports":
+		if s.punct('=') {
+			s.space()
+			return WrapperModuleExports
+		}
+	case "":
+	default:
+		if s.punct('(') {
+			s.space()
+			return WrapperJSONP
+		}
+	}
+	return ""
+}
+
+// assignment matches `name [: Type] =` after const, let or var.
+func (s *codeScanner) assignment() string {
+	if name := s.path(); name == "" || strings.Contains(name, ".") {
+		return ""
+	}
+	if s.punct(':') && s.path() == "" {
+		return ""
+	}
+	if !s.punct('=') || (s.pos < len(s.in) && s.in[s.pos] == '=') {
+		return ""
+	}
+	s.space()
+	return WrapperAssignment
+}
+
+// path skips space and returns the identifier or dotted member path at
+// pos, or "".
+func (s *codeScanner) path() string {
+	s.space()
+	start := s.pos
+	for {
+		if !s.ident() {
+			s.pos = start
+			return ""
+		}
+		if s.pos == len(s.in) || s.in[s.pos] != '.' {
+			return string(s.in[start:s.pos])
+		}
+		s.pos++
+	}
+}
+
+// ident consumes a JavaScript identifier.
+func (s *codeScanner) ident() bool {
+	start := s.pos
+	for s.pos < len(s.in) {
+		c := s.in[s.pos]
+		if !(c == '_' || c == '$' || isAlpha(c) || (s.pos > start && '0' <= c && c <= '9')) {
+			break
+		}
+		s.pos++
+	}
+	return s.pos > start
+}
+
+// punct skips space and consumes c when it comes next.
+func (s *codeScanner) punct(c byte) bool {
+	s.space()
+	if s.pos < len(s.in) && s.in[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+// space skips whitespace and comments.
+func (s *codeScanner) space() {
+	for s.pos < len(s.in) {
+		lx := newTolerantLexer(s.in, s.pos, true)
+		switch t := lx.next(); t.kind {
+		case tokWhitespace, tokLineComment, tokBlockComment:
+			s.pos = t.end
+		default:
+			return
+		}
+	}
+}
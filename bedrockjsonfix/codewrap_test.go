@@ -0,0 +1,83 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCodeWrapper(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty = false
+	tests := []struct {
+		input   string
+		want    string
+		wrapper string
+	}{
+		{"const manifest = {\"a\": 1};\nconsole.log(manifest);", `{"a":1}`, WrapperAssignment},
+		{"let x: Manifest = [1, 2,]\nfoo()", `[1,2]`, WrapperAssignment},
+		{"export const data = {\"b\": [{\"c\": 2}]};", `{"b":[{"c":2}]}`, WrapperAssignment},
+		{"// config\nmodule.exports = {\"d\": 4}; module.exports.x = {};", `{"d":4}`, WrapperModuleExports},
+		{"export default {\"e\": 5}\n", `{"e":5}`, WrapperExportDefault},
+		{"callback({\"f\": 6});", `{"f":6}`, WrapperJSONP},
+		{"window.jQuery_1 ( [7] ) ;\n", `[7]`, WrapperJSONP},
+		{"\uFEFFconst x = {\"a\":1};\nconst y = {\"b\":2};", `{"a":1}`, WrapperAssignment},
+	}
+	for _, tt := range tests {
+		res, err := FixString(tt.input, opt)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.input, err)
+		}
+		if got := strings.TrimSuffix(string(res.Output), "\n"); got != tt.want {
+			t.Fatalf("%q: output = %q, want %q", tt.input, got, tt.want)
+		}
+		rep := res.Report
+		if rep.CodeWrapper != tt.wrapper || rep.Repairs&RepairCodeWrapper == 0 {
+			t.Fatalf("%q: CodeWrapper = %q, Repairs = %s, want %q", tt.input, rep.CodeWrapper, rep.Repairs, tt.wrapper)
+		}
+		if bom := strings.HasPrefix(tt.input, "\uFEFF"); bom != (rep.Repairs&RepairBOM != 0) || bom != (rep.RemovedBOM == 1) {
+			t.Fatalf("%q: RemovedBOM = %d, Repairs = %s", tt.input, rep.RemovedBOM, rep.Repairs)
+		}
+		if rep.TrimmedLeadingJunkBytes != 0 || rep.TrimmedTrailingJunkBytes != 0 || rep.DroppedJunkOutsideStrings != 0 {
+			t.Fatalf("%q: wrapper counted as junk: %+v", tt.input, rep)
+		}
+	}
+}
+
+func TestCodeWrapperNotMatched(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty = false
+	for _, input := range []string{
+		`const x == {"a":1}`,
+		`const a.b = {"a":1}`,
+		`callback({"a":1}, 2)`,
+		`const x = {"a":1} || fallback`,
+		`{"a":1}`,
+		`note: {"a":1}`,
+	} {
+		res, err := FixString(input, opt)
+		if err == nil && res.Report.CodeWrapper != "" {
+			t.Fatalf("%q: CodeWrapper = %q, want none", input, res.Report.CodeWrapper)
+		}
+	}
+}
+
+func TestCodeWrapperDisabled(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Fixes = RepairsBedrock &^ RepairCodeWrapper
+	res, err := FixString("const x = {\"a\": 1};", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Report.CodeWrapper != "" || res.Report.TrimmedLeadingJunkBytes == 0 {
+		t.Fatalf("report = %+v, want generic junk trimming", res.Report)
+	}
+}
+
+func TestCodeWrapperErrorPosition(t *testing.T) {
+	_, err := FixString("const x = {\n  \"a\": 1\n  \"b\": 2\n};", DefaultOptions())
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Line != 3 || fe.Column != 3 {
+		t.Fatalf("error = %v, want line 3, column 3", err)
+	}
+}
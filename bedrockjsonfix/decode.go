@@ -12,29 +12,31 @@ var cp1252SpecialRunes = [32]rune{
 	'˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
 }
 
-func decodeInput(input []byte, opt Options, rep *Report) ([]byte, error) {
+func decodeInput(input []byte, opt Options, rep *Report, m *offsetMap) ([]byte, error) {
 	if utf8.Valid(input) {
 		return input, nil
 	}
 	rep.InputWasInvalidUTF8 = true
 	if !opt.AllowCP1252Fallback {
-		return nil, &FixError{Code: "invalid_encoding", Message: "input must be valid UTF-8", Cause: ErrInvalidJSON}
+		pos := positionAt(input, firstInvalidUTF8(input))
+		return nil, &FixError{Code: "invalid_encoding", Message: "input must be valid UTF-8", Cause: ErrInvalidJSON, Position: pos, Snippet: snippetAt(input, pos), Reason: "invalid UTF-8 sequence", Stage: StageDecode}
 	}
-	out := decodeCP1252(input)
+	out := decodeCP1252(input, m)
 	rep.UsedCP1252Fallback = true
 	return out, nil
 }
 
-func decodeCP1252(input []byte) []byte {
+func decodeCP1252(input []byte, m *offsetMap) []byte {
 	var b bytes.Buffer
 	b.Grow(len(input))
-	for _, c := range input {
+	for i, c := range input {
 		if c < 0x80 {
 			b.WriteByte(c)
 			continue
 		}
 		r := cp1252Rune(c)
 		b.WriteRune(r)
+		m.mark(b.Len(), i+1)
 	}
 	return b.Bytes()
 }
@@ -45,3 +47,14 @@ func cp1252Rune(c byte) rune {
 	}
 	return rune(c)
 }
+
+func firstInvalidUTF8(input []byte) int {
+	for i := 0; i < len(input); {
+		r, sz := utf8.DecodeRune(input[i:])
+		if r == utf8.RuneError && sz == 1 {
+			return i
+		}
+		i += sz
+	}
+	return len(input)
+}
@@ -0,0 +1,321 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Decoder repairs a stream of concatenated JSON documents, such as JSON
+// Lines or log output with JSON objects between other text, one document at
+// a time.
+//
+// A document starts at the first '{' or '[' after the previous one that is
+// not in a string or comment; the bytes before it are skipped and counted
+// in Report.TrimmedLeadingJunkBytes, not counting whitespace. It ends where
+// its brackets balance. When a document is left open and a line starts with
+// '{' or '[' after a value that is not followed by ',' or ':', that line
+// starts the next document, and when a document cannot be repaired, the
+// search for the next one resumes on the line after its first, so one
+// broken line of a JSON Lines stream does not swallow the rest. Bracketed
+// text that repairs to an empty object or array, such as a "[INFO]" log
+// level, is skipped like other junk.
+//
+// Each document is repaired with the Decoder's options and must fit in
+// Options.MaxInputBytes. A Decoder is not safe for concurrent use.
+type Decoder struct {
+	r     io.Reader
+	fixer *Fixer
+
+	buf []byte
+	pos int // start of the unconsumed part of buf
+	at  Position
+	eof bool
+	err error // sticky read error
+
+	skipped int // junk bytes skipped before the next document
+	scan    frameScan
+}
+
+// frameScan is how far frame got in the unconsumed input, so that a frame
+// that needs more input resumes after fill instead of scanning again.
+type frameScan struct {
+	from  int // where the search for a document start resumes
+	start int // start of the document, or -1 while none is found
+	end   endScan
+	// need is the buffer length to wait for before scanning again. A
+	// token that reaches the end of the buffer is scanned again from its
+	// start, so the scan waits until the token could have doubled.
+	need int
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader, opt Options) (*Decoder, error) {
+	f, err := NewFixer(opt)
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{r: r, fixer: f, at: Position{Line: 1, Column: 1}, scan: frameScan{start: -1}}, nil
+}
+
+// Next is NextContext with context.Background.
+func (d *Decoder) Next() (Result, error) {
+	return d.NextContext(context.Background())
+}
+
+// NextContext repairs and returns the next document. Result.Offset is the
+// input offset of the document. A document that cannot be repaired returns
+// its error, positioned in the whole input though the snippet shows the
+// document alone, and the next call continues after it. At the end of input
+// NextContext returns io.EOF. Read errors and documents larger than
+// MaxInputBytes end the stream.
+func (d *Decoder) NextContext(ctx context.Context) (Result, error) {
+	if d.err != nil {
+		return Result{}, d.err
+	}
+	opt := d.fixer.Options()
+	for {
+		if ctx.Err() != nil {
+			return Result{}, contextCanceledError()
+		}
+		start, end, ok := d.frame()
+		if ok {
+			res, found, err := d.document(ctx, start, end)
+			if !found {
+				continue
+			}
+			return res, err
+		}
+		pending := start
+		if start < 0 {
+			pending = end
+		}
+		if n := int64(len(d.buf) - d.pos - pending); n > opt.MaxInputBytes {
+			d.err = inputTooLargeError(n, opt.MaxInputBytes)
+			return Result{}, d.err
+		}
+		if start < 0 {
+			s := d.scan
+			d.skip(end)
+			s.from -= end
+			s.need -= end
+			d.scan = s
+			if d.eof {
+				d.err = io.EOF
+				return Result{}, io.EOF
+			}
+		}
+		if err := d.fill(); err != nil {
+			d.err = err
+			return Result{}, err
+		}
+	}
+}
+
+// document repairs d.buf[d.pos+start : d.pos+end] and consumes it. found
+// is false when the document repaired to an empty container and was
+// skipped as junk.
+func (d *Decoder) document(ctx context.Context, start, end int) (res Result, found bool, err error) {
+	d.skip(start)
+	src := d.buf[d.pos : d.pos+end-start]
+	if limit := d.fixer.Options().MaxInputBytes; int64(len(src)) > limit {
+		d.err = inputTooLargeError(int64(len(src)), limit)
+		return Result{}, true, d.err
+	}
+	at := d.at
+	doc := src
+	if d.fixer.Options().BuildSourceMap {
+		// The source map keeps the input, and buf is reused.
+		doc = bytes.Clone(doc)
+	}
+	_, res, err = d.fixer.FixContext(ctx, nil, doc)
+	if err != nil {
+		// Resume on the next line, which may start a document that an
+		// unclosed bracket on this one swallowed.
+		n := len(src)
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			n = i + 1
+		}
+		d.consume(n)
+		d.skipped = 0
+		var fe *FixError
+		if errors.As(err, &fe) && fe.Line > 0 {
+			fe.Position = offsetPosition(at, fe.Position)
+			if fe.Reason != "" {
+				fe.Message = fmt.Sprintf("line %d, column %d: %s", fe.Line, fe.Column, fe.Reason)
+			}
+		}
+		return Result{}, true, err
+	}
+	if emptyContainer(res.Output) && !emptyContainer(src) {
+		d.skip(len(src))
+		return Result{}, false, nil
+	}
+	d.consume(len(src))
+	res.Report.TrimmedLeadingJunkBytes += d.skipped
+	d.skipped = 0
+	res.Offset = int64(at.Offset)
+	return res, true, nil
+}
+
+// frame finds the next document in the unconsumed input. ok is false when
+// more input is needed to find its end. start is -1 when there is no
+// document yet, and then end is the number of bytes that can be skipped.
+// The scan resumes where the previous call stopped, so a document that
+// arrives in many small reads is scanned once.
+func (d *Decoder) frame() (start, end int, ok bool) {
+	b := d.buf[d.pos:]
+	s := &d.scan
+	if len(b) < s.need && !d.eof {
+		if s.start < 0 {
+			return -1, 0, false
+		}
+		return s.start, len(b), false
+	}
+	if s.start < 0 {
+		start, scanned, resume := documentStart(b, s.from, d.eof)
+		if start < 0 {
+			s.from, s.need = resume, 2*len(b)-resume
+			return -1, scanned, false
+		}
+		s.start, s.end = start, endScan{pos: start, continues: true}
+	}
+	end, ok = s.end.scan(b, d.eof)
+	if !ok {
+		s.need = 2*len(b) - s.end.pos
+	}
+	return s.start, end, ok || d.eof
+}
+
+// documentStart returns the offset of the first '{' or '[' at or after
+// from in b outside strings and comments, or -1, how many bytes of b can be
+// skipped without finding one and where the scan resumes. Unless final is
+// set, a token that reaches the end of b may continue in more input and is
+// scanned again; the byte before it is kept, since "//" after anything but
+// whitespace is not a comment, so URLs in log lines do not hide documents.
+func documentStart(b []byte, from int, final bool) (start, scanned, resume int) {
+	lx := newTolerantLexer(b, from, true)
+	for {
+		t := lx.next()
+		if t.kind == tokEOF {
+			return -1, len(b), len(b)
+		}
+		if t.end == len(b) && !final {
+			scanned = max(t.start-1, 0)
+			return -1, scanned, t.start
+		}
+		switch t.kind {
+		case tokPunct:
+			if b[t.start] == '{' || b[t.start] == '[' {
+				return t.start, t.start, t.start
+			}
+		case tokLineComment:
+			if t.start > 0 && !isSpace(b[t.start-1]) {
+				lx = newTolerantLexer(b, t.start+2, true)
+			}
+		}
+	}
+}
+
+// documentEnd returns the end of the document that starts with the bracket
+// at b[start]: where its brackets balance, or where a line starts a new
+// document as described on Decoder. ok is false when b ends first, and then
+// end is len(b). Unless final is set, a token that reaches the end of b may
+// continue in more input and also reports !ok.
+func documentEnd(b []byte, start int, final bool) (end int, ok bool) {
+	s := endScan{pos: start, continues: true}
+	return s.scan(b, final)
+}
+
+// endScan is the state of documentEnd between calls on a buffer that
+// grows: the first token not yet scanned and the nesting seen before it.
+type endScan struct {
+	pos       int
+	depth     int
+	continues bool // the last token asks for another value
+}
+
+// scan continues the documentEnd scan over b, which starts with the bytes
+// of the previous call.
+func (s *endScan) scan(b []byte, final bool) (end int, ok bool) {
+	lx := newTolerantLexer(b, s.pos, true)
+	for {
+		t := lx.next()
+		if t.kind == tokEOF || (t.end == len(b) && !final) {
+			s.pos = t.start
+			return len(b), false
+		}
+		switch t.kind {
+		case tokWhitespace, tokLineComment, tokBlockComment:
+			continue
+		case tokPunct:
+			switch b[t.start] {
+			case '{', '[':
+				if s.depth > 0 && !s.continues && b[t.start-1] == '\n' {
+					return t.start, true
+				}
+				s.depth++
+				s.continues = true
+			case '}', ']':
+				s.depth--
+				if s.depth == 0 {
+					return t.end, true
+				}
+				s.continues = false
+			default:
+				s.continues = true
+			}
+		default:
+			s.continues = false
+		}
+	}
+}
+
+// skip consumes n bytes of junk.
+func (d *Decoder) skip(n int) {
+	for _, c := range d.buf[d.pos : d.pos+n] {
+		if !isSpace(c) {
+			d.skipped++
+		}
+	}
+	d.consume(n)
+}
+
+func (d *Decoder) consume(n int) {
+	d.at = advancePosition(d.at, d.buf[d.pos:d.pos+n])
+	d.pos += n
+	d.scan = frameScan{start: -1}
+}
+
+// fill reads more input, growing buf when it is full.
+func (d *Decoder) fill() error {
+	if d.pos > 0 {
+		n := copy(d.buf, d.buf[d.pos:])
+		d.buf, d.pos = d.buf[:n], 0
+	}
+	if len(d.buf) == cap(d.buf) {
+		grown := make([]byte, len(d.buf), max(2*cap(d.buf), readerChunkSize))
+		copy(grown, d.buf)
+		d.buf = grown
+	}
+	n, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+	d.buf = d.buf[:len(d.buf)+n]
+	if errors.Is(err, io.EOF) {
+		d.eof = true
+		return nil
+	}
+	return err
+}
+
+// offsetPosition converts p, a position within a document starting at
+// base, to a position in the whole input.
+func offsetPosition(base, p Position) Position {
+	p.Offset += base.Offset
+	if p.Line == 1 {
+		p.Column += base.Column - 1
+	}
+	p.Line += base.Line - 1
+	return p
+}
@@ -0,0 +1,201 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func decodeAll(t *testing.T, r io.Reader, opt Options) ([]Result, []error) {
+	t.Helper()
+	d, err := NewDecoder(r, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []Result
+	var errs []error
+	for range 100 {
+		res, err := d.NextContext(t.Context())
+		if errors.Is(err, io.EOF) {
+			return results, errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		results = append(results, res)
+	}
+	t.Fatal("decoder did not reach io.EOF")
+	return nil, nil
+}
+
+func TestDecoderDocuments(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty, opt.PreserveIfValid = false, false
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		offsets []int64
+		errs    int
+	}{
+		{"json lines", "{\"a\":1}\n{\"b\":2,}\n[3]\n", []string{`{"a":1}`, `{"b":2}`, `[3]`}, []int64{0, 8, 17}, 0},
+		{"concatenated", `{"a":1}{"b":2} [3]`, []string{`{"a":1}`, `{"b":2}`, `[3]`}, []int64{0, 7, 15}, 0},
+		{"junk between", "log: {\"a\":1} ok\nlog: {\"b\":2}\n", []string{`{"a":1}`, `{"b":2}`}, []int64{5, 21}, 0},
+		{"broken line", "{\"a\":1\n{\"b\":2}\n", []string{`{"b":2}`}, []int64{7}, 1},
+		{"multi-line document", "{\n  \"a\": [\n1,\n2\n]\n}\n{\"b\":2}", []string{`{"a":[1,2]}`, `{"b":2}`}, []int64{0, 20}, 0},
+		{"unclosed at end", `{"a":1} {"b":[2`, []string{`{"a":1}`}, []int64{0}, 1},
+		{"brackets in strings", `{"a":"}{"} {"b":"]"}`, []string{`{"a":"}{"}`, `{"b":"]"}`}, []int64{0, 11}, 0},
+		{"log levels", "{\"a\":1}\n2024-01-01 [INFO] started\n{\"b\":2}", []string{`{"a":1}`, `{"b":2}`}, []int64{0, 34}, 0},
+		{"bracket in junk string", "{\"a\":1}\n\"msg {\" \n{\"b\":2}", []string{`{"a":1}`, `{"b":2}`}, []int64{0, 17}, 0},
+		{"bracket in comment", "{\"a\":1}  // c {\n{\"b\":2}", []string{`{"a":1}`, `{"b":2}`}, []int64{0, 16}, 0},
+		{"url before document", "GET http://x/ {\"a\":1}", []string{`{"a":1}`}, []int64{14}, 0},
+		{"truncated line", "{\"a\": \n{\"b\":1}\n", []string{`{"b":1}`}, []int64{7}, 1},
+		{"truncated line then more", "{\"a\": \n{\"b\":1}\n{\"c\":2}\n", []string{`{"b":1}`, `{"c":2}`}, []int64{7, 15}, 1},
+		{"empty containers", "[]\n{ }", []string{`[]`, `{}`}, []int64{0, 3}, 0},
+		{"empty", "  \n", nil, nil, 0},
+		{"junk only", "no json here", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, r := range []io.Reader{strings.NewReader(tt.input), iotest.OneByteReader(strings.NewReader(tt.input))} {
+				results, errs := decodeAll(t, r, opt)
+				if len(errs) != tt.errs {
+					t.Fatalf("errors: %v, want %d", errs, tt.errs)
+				}
+				if len(results) != len(tt.want) {
+					t.Fatalf("got %d documents, want %d", len(results), len(tt.want))
+				}
+				for i, res := range results {
+					if string(res.Output) != tt.want[i]+"\n" || res.Offset != tt.offsets[i] {
+						t.Fatalf("document %d = %q at %d, want %q at %d", i, res.Output, res.Offset, tt.want[i], tt.offsets[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderSkippedJunk(t *testing.T) {
+	results, _ := decodeAll(t, strings.NewReader("ab {\"a\":1} c d\n{\"b\":2}"), DefaultOptions())
+	if len(results) != 2 {
+		t.Fatalf("got %d documents", len(results))
+	}
+	if got := results[0].Report.TrimmedLeadingJunkBytes; got != 2 {
+		t.Fatalf("first TrimmedLeadingJunkBytes = %d, want 2", got)
+	}
+	if got := results[1].Report.TrimmedLeadingJunkBytes; got != 2 {
+		t.Fatalf("second TrimmedLeadingJunkBytes = %d, want 2", got)
+	}
+}
+
+func TestDecoderErrorContinues(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty, opt.PreserveIfValid = false, false
+	results, errs := decodeAll(t, strings.NewReader("{\"a\":1}\n\n  {\"b\" 2 3 4}\n{\"c\":3}\n"), opt)
+	if len(results) != 2 || string(results[1].Output) != "{\"c\":3}\n" {
+		t.Fatalf("results = %v", results)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("errors = %v", errs)
+	}
+	var fe *FixError
+	if !errors.As(errs[0], &fe) || !errors.Is(errs[0], ErrInvalidJSON) {
+		t.Fatalf("error = %v, want ErrInvalidJSON", errs[0])
+	}
+	if fe.Line != 3 || fe.Offset < 11 || !strings.HasPrefix(fe.Message, "line 3, column ") {
+		t.Fatalf("error at %+v: %s, want line 3 of the input", fe.Position, fe.Message)
+	}
+}
+
+func TestDecoderMaxInputBytes(t *testing.T) {
+	opt := DefaultOptions()
+	opt.MaxInputBytes = 16
+	d, err := NewDecoder(strings.NewReader(`{"a":1} {"b":"0123456789abcdef"} {"c":3}`), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Next(); !errors.Is(err, ErrInputTooLarge) {
+		t.Fatalf("error = %v, want ErrInputTooLarge", err)
+	}
+	if _, err := d.Next(); !errors.Is(err, ErrInputTooLarge) {
+		t.Fatalf("error after limit = %v, want it to stick", err)
+	}
+}
+
+func TestDecoderReadError(t *testing.T) {
+	boom := errors.New("boom")
+	d, err := NewDecoder(io.MultiReader(strings.NewReader(`{"a":1} {"b":`), iotest.ErrReader(boom)), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Next(); !errors.Is(err, boom) {
+		t.Fatalf("error = %v, want the read error", err)
+	}
+}
+
+// checkedReader returns at most n bytes per Read and calls check first.
+type checkedReader struct {
+	r     io.Reader
+	n     int
+	check func()
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	if c.check != nil {
+		c.check()
+	}
+	return c.r.Read(p[:min(len(p), c.n)])
+}
+
+func TestDecoderSmallReadsResumeScan(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty, opt.PreserveIfValid = false, false
+	junk := strings.Repeat("log line ", 20000)
+	doc := `{"a":[` + strings.Repeat("1, ", 100000) + "1]}"
+	var d *Decoder
+	r := &checkedReader{r: strings.NewReader(junk + doc + "\n" + junk), n: 4096}
+	r.check = func() {
+		// Only the last, unfinished token is scanned again.
+		scanned := d.scan.from
+		if d.scan.start >= 0 {
+			scanned = d.scan.end.pos
+		}
+		if rest := len(d.buf) - d.pos - scanned; rest > 8 {
+			t.Fatalf("%d buffered bytes will be scanned again", rest)
+		}
+	}
+	d, err := NewDecoder(r, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Offset != int64(len(junk)) || len(res.Output) != len(doc)-100000+1 {
+		t.Fatalf("offset = %d, output %d bytes", res.Offset, len(res.Output))
+	}
+	if _, err := d.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("error = %v, want io.EOF", err)
+	}
+}
+
+func TestDecoderSmallReadsLongTokens(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty, opt.PreserveIfValid = false, false
+	long := strings.Repeat("x", 1<<20)
+	input := "// " + long + "\n{\"a\":\"" + long + "\"} // " + long + "\n[1]"
+	results, errs := decodeAll(t, &checkedReader{r: strings.NewReader(input), n: 4096}, opt)
+	if len(errs) != 0 || len(results) != 2 || len(results[0].Output) != len(long)+9 || string(results[1].Output) != "[1]\n" {
+		t.Fatalf("%d results, errors %v", len(results), errs)
+	}
+}
@@ -0,0 +1,175 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	snippetMaxRunes   = 72
+	snippetLeadRunes  = 40
+	snippetEllipsis   = "..."
+	reasonRootDenied  = "root rejected by validator"
+	reasonTrailing    = "unexpected data after the JSON document"
+	reasonEndOfInput  = "unexpected end of input"
+	reasonInvalidJSON = "invalid JSON"
+)
+
+// parseErrorOffset returns the candidate offset a parse error points at.
+func parseErrorOffset(candidate []byte, err error) int {
+	var syn *json.SyntaxError
+	var trailing *trailingDataError
+	var emit *emitError
+	switch {
+	case errors.As(err, &emit):
+		return clampOffset(emit.offset, len(candidate))
+	case errors.As(err, &trailing):
+		return clampOffset(int(trailing.Offset), len(candidate))
+	case errors.As(err, &syn):
+		return clampOffset(int(syn.Offset)-1, len(candidate))
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return len(candidate)
+	default:
+		i := 0
+		for i < len(candidate) && isSpace(candidate[i]) {
+			i++
+		}
+		return i
+	}
+}
+
+func clampOffset(off, n int) int {
+	if off < 0 {
+		return 0
+	}
+	if off > n {
+		return n
+	}
+	return off
+}
+
+// describeParseError turns encoding/json wording into a short user-facing reason.
+func describeParseError(err error) string {
+	var syn *json.SyntaxError
+	var trailing *trailingDataError
+	var emit *emitError
+	switch {
+	case errors.Is(err, errRootRejected):
+		return reasonRootDenied
+	case errors.As(err, &emit):
+		return emit.reason
+	case errors.As(err, &trailing):
+		return reasonTrailing
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return reasonEndOfInput
+	case errors.As(err, &syn):
+	default:
+		return reasonInvalidJSON
+	}
+	msg := syn.Error()
+	found := ""
+	if rest, ok := strings.CutPrefix(msg, "invalid character "); ok {
+		if end := strings.Index(rest, " "); end > 0 {
+			found = rest[:end]
+		}
+	}
+	var reason string
+	switch {
+	case strings.Contains(msg, "after object key:value pair"):
+		reason = "expected ',' or '}' after object member"
+	case strings.Contains(msg, "after object key"):
+		reason = "expected ':' after object key"
+	case strings.Contains(msg, "after array element"):
+		reason = "expected ',' or ']' after array element"
+	case strings.Contains(msg, "looking for beginning of object key string"):
+		reason = "expected string object key"
+	case strings.Contains(msg, "looking for beginning of value"):
+		reason = "expected a value"
+	case strings.Contains(msg, "in string"):
+		reason = "invalid character in string"
+	case strings.Contains(msg, "in literal"):
+		reason = "invalid literal"
+	case strings.Contains(msg, "in numeric literal"):
+		reason = "invalid number"
+	default:
+		return msg
+	}
+	if found != "" {
+		reason += ", found " + found
+	}
+	return reason
+}
+
+// snippetAt renders the input line containing pos followed by a caret line
+// pointing at pos.Column. Long lines are cut around the column.
+func snippetAt(input []byte, pos Position) string {
+	if pos.Line == 0 {
+		return ""
+	}
+	start := bytes.LastIndexByte(input[:pos.Offset], '\n') + 1
+	end := start
+	for end < len(input) && input[end] != '\n' && input[end] != '\r' {
+		end++
+	}
+	line := input[start:end]
+	if !utf8.Valid(line) {
+		line = decodeCP1252(line, nil)
+	}
+	runes := []rune(string(line))
+	col := pos.Column - 1
+	if col > len(runes) {
+		col = len(runes)
+	}
+	prefix := ""
+	if col > snippetLeadRunes {
+		cut := col - snippetLeadRunes
+		runes = runes[cut:]
+		col -= cut
+		prefix = snippetEllipsis
+	}
+	suffix := ""
+	if len(runes) > snippetMaxRunes {
+		runes = runes[:snippetMaxRunes]
+		suffix = snippetEllipsis
+	}
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString(string(runes))
+	b.WriteString(suffix)
+	b.WriteByte('\n')
+	b.WriteString(strings.Repeat(" ", len(prefix)))
+	for _, r := range runes[:col] {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	return b.String()
+}
+
+// invalidJSONError builds the invalid_json error for a parse failure located
+// at inputOffset in the original input.
+func invalidJSONError(input []byte, inputOffset int, cause error, stage string, candidate int) *FixError {
+	pos := positionAt(input, inputOffset)
+	return newInvalidJSONError(pos, snippetAt(input, pos), describeParseError(cause), cause, stage, candidate)
+}
+
+func newInvalidJSONError(pos Position, snippet, reason string, cause error, stage string, candidate int) *FixError {
+	return &FixError{
+		Code:      "invalid_json",
+		Message:   fmt.Sprintf("line %d, column %d: %s", pos.Line, pos.Column, reason),
+		Cause:     errors.Join(ErrInvalidJSON, cause),
+		Position:  pos,
+		Snippet:   snippet,
+		Reason:    reason,
+		Stage:     stage,
+		Candidate: candidate,
+	}
+}
@@ -0,0 +1,676 @@
+package bedrockjsonfix
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// emitError is a grammar error found by the emitter. offset is set by
+// document; streaming callers add their own position instead. limit names
+// the Options field of a structural limit that was exceeded.
+type emitError struct {
+	reason string
+	offset int
+	eof    bool
+	limit  string
+}
+
+func (e *emitError) Error() string { return e.reason }
+
+// errDiscardedInvalid is returned by a discarding emitter instead of an
+// *emitError, since validDocument only needs a yes or no.
+var errDiscardedInvalid = errors.New("invalid JSON")
+
+type emitState uint8
+
+const (
+	emitRoot emitState = iota
+	emitArrayStart
+	emitObjectStart
+	emitArrayValue
+	emitObjectKey
+	emitColon
+	emitMemberValue
+	emitAfterValue
+	emitDone
+)
+
+// emitter validates a sequence of strict JSON tokens and writes them to out
+// with the configured indentation. Strings are re-encoded the way
+// encoding/json encodes them, so output matches json.Marshal byte for byte
+// apart from member order. Memory is bounded by the nesting depth.
+type emitter struct {
+	out    []byte
+	pretty bool
+	prefix string
+	indent string
+
+	// discard validates without keeping output: out is truncated after
+	// every token and strings and scalars are checked but not written.
+	discard bool
+
+	// ctx, when set, is polled every cancelCheckBytes by document.
+	ctx context.Context
+
+	stack   []byte
+	state   emitState
+	root    RootKind
+	scratch []byte
+
+	// counts holds the members or elements seen by each open container,
+	// parallel to stack, while limits are enforced.
+	lim    emitLimits
+	counts []int
+	tokens int
+
+	// notes, when set, are comments to write back for OutputJSONC.
+	notes *jsoncComments
+}
+
+func newEmitter(opt Options) emitter {
+	return emitter{pretty: opt.Pretty, prefix: opt.Prefix, indent: opt.Indent, root: RootUnknown, lim: limitsFromOptions(opt)}
+}
+
+// token counts one accepted token against MaxTokens.
+func (e *emitter) token() error {
+	e.tokens++
+	if e.lim.tokens > 0 && e.tokens > e.lim.tokens {
+		return exceeded("MaxTokens", "token count", e.lim.tokens)
+	}
+	return nil
+}
+
+// member counts an object member or array element of the innermost
+// container against its limit.
+func (e *emitter) member(object bool) error {
+	top := len(e.counts) - 1
+	e.counts[top]++
+	switch {
+	case object && e.lim.members > 0 && e.counts[top] > e.lim.members:
+		return exceeded("MaxObjectMembers", "object member count", e.lim.members)
+	case !object && e.lim.elements > 0 && e.counts[top] > e.lim.elements:
+		return exceeded("MaxArrayElements", "array element count", e.lim.elements)
+	}
+	return nil
+}
+
+func (e *emitter) done() bool { return e.state == emitDone }
+
+// document lexes a complete strict JSON document and emits it.
+func (e *emitter) document(in []byte) error {
+	lx := newTolerantLexer(in, 0, false)
+	nextCheck := cancelCheckBytes
+	if e.notes != nil {
+		e.notes.reset()
+	}
+	for {
+		t := lx.next()
+		raw := in[t.start:t.end]
+		off := t.start
+		var err error
+		if e.notes != nil && t.kind != tokWhitespace {
+			if t.kind == tokEOF {
+				e.notes.queue(math.MaxInt)
+			} else {
+				e.notes.queue(off)
+			}
+		}
+		switch t.kind {
+		case tokEOF:
+			if err := e.finish(); err != nil {
+				return atOffset(err, len(in))
+			}
+			return nil
+		case tokWhitespace:
+			if t.flags&^flagCR == 0 {
+				continue
+			}
+			for off < t.end && isSpace(in[off]) {
+				off++
+			}
+			err = e.unexpected(in[off])
+		case tokString:
+			if t.flags&flagUnterminated != 0 {
+				return atOffset(&emitError{reason: reasonEndOfInput, eof: true}, len(in))
+			}
+			if e.done() {
+				return &trailingDataError{Offset: int64(off)}
+			}
+			err = e.str(raw)
+		case tokNumber:
+			if e.done() {
+				return &trailingDataError{Offset: int64(off)}
+			}
+			err = e.number(raw)
+		case tokLiteral:
+			if e.done() {
+				return &trailingDataError{Offset: int64(off)}
+			}
+			err = e.scalar(raw)
+		case tokPunct:
+			if e.done() && (raw[0] == '{' || raw[0] == '[') {
+				return &trailingDataError{Offset: int64(off)}
+			}
+			switch raw[0] {
+			case '{', '[':
+				err = e.open(raw[0])
+			case '}', ']':
+				err = e.close(raw[0])
+			case ':':
+				err = e.colon()
+			case ',':
+				err = e.comma()
+			}
+		default:
+			err = e.unexpected(raw[0])
+		}
+		if err != nil {
+			return atOffset(err, off)
+		}
+		if e.discard {
+			e.out = e.out[:0]
+		}
+		if e.ctx != nil && t.end >= nextCheck {
+			if e.ctx.Err() != nil {
+				return contextCanceledError()
+			}
+			nextCheck = t.end + cancelCheckBytes
+		}
+	}
+}
+
+func atOffset(err error, off int) error {
+	if ee, ok := err.(*emitError); ok {
+		ee.offset = off
+	}
+	return err
+}
+
+// expectsKey reports whether the next string token is an object key.
+func (e *emitter) expectsKey() bool {
+	return e.state == emitObjectStart || e.state == emitObjectKey
+}
+
+func (e *emitter) newline(depth int) {
+	if !e.pretty {
+		return
+	}
+	e.out = append(e.out, '\n')
+	e.out = append(e.out, e.prefix...)
+	for range depth {
+		e.out = append(e.out, e.indent...)
+	}
+}
+
+// beginValue checks that a value may start here and writes the separator
+// before it. found is the first byte of the token, for error messages.
+func (e *emitter) beginValue(found byte) error {
+	switch e.state {
+	case emitRoot:
+		e.writeLeadingComments()
+	case emitMemberValue:
+	case emitArrayStart:
+		e.writeComments(len(e.stack))
+		e.newline(len(e.stack))
+	case emitArrayValue:
+		e.out = append(e.out, ',')
+		e.writeComments(len(e.stack))
+		e.newline(len(e.stack))
+	default:
+		return e.unexpected(found)
+	}
+	if e.state == emitArrayStart || e.state == emitArrayValue {
+		return e.member(false)
+	}
+	return nil
+}
+
+func (e *emitter) endValue() {
+	if len(e.stack) == 0 {
+		e.state = emitDone
+	} else {
+		e.state = emitAfterValue
+	}
+}
+
+// scalar writes a number or literal lexeme verbatim.
+func (e *emitter) scalar(raw []byte) error {
+	if err := e.beginValue(raw[0]); err != nil {
+		return err
+	}
+	if err := e.token(); err != nil {
+		return err
+	}
+	if !e.discard {
+		e.out = append(e.out, raw...)
+	}
+	e.endValue()
+	return nil
+}
+
+// number validates and writes a number lexeme.
+func (e *emitter) number(raw []byte) error {
+	if !isJSONNumber(raw) {
+		if err := e.beginValue(raw[0]); err != nil {
+			return err
+		}
+		return &emitError{reason: "invalid number " + strconv.Quote(string(raw))}
+	}
+	return e.scalar(raw)
+}
+
+// str writes a complete string lexeme, including quotes, as a key or value.
+func (e *emitter) str(raw []byte) error {
+	switch e.state {
+	case emitObjectStart:
+		e.writeComments(len(e.stack))
+		e.newline(len(e.stack))
+	case emitObjectKey:
+		e.out = append(e.out, ',')
+		e.writeComments(len(e.stack))
+		e.newline(len(e.stack))
+	default:
+		if err := e.beginValue('"'); err != nil {
+			return err
+		}
+	}
+	key := e.expectsKey()
+	if key {
+		if err := e.member(true); err != nil {
+			return err
+		}
+	}
+	if err := e.token(); err != nil {
+		return err
+	}
+	if e.lim.stringBytes > 0 && len(raw)-2 > e.lim.stringBytes {
+		return exceeded("MaxStringBytes", "string length", e.lim.stringBytes)
+	}
+	var err error
+	if e.discard {
+		err = checkJSONString(raw)
+	} else {
+		e.out, e.scratch, err = appendReencodedString(e.out, e.scratch, raw)
+	}
+	if err != nil {
+		return err
+	}
+	if key {
+		e.state = emitColon
+	} else {
+		e.endValue()
+	}
+	return nil
+}
+
+func (e *emitter) open(c byte) error {
+	if err := e.beginValue(c); err != nil {
+		return err
+	}
+	if err := e.token(); err != nil {
+		return err
+	}
+	if e.lim.depth > 0 && len(e.stack) >= e.lim.depth {
+		return exceeded("MaxDepth", "nesting depth", e.lim.depth)
+	}
+	if e.state == emitRoot {
+		e.root = RootArray
+		if c == '{' {
+			e.root = RootObject
+		}
+	}
+	e.out = append(e.out, c)
+	e.stack = append(e.stack, c)
+	e.counts = append(e.counts, 0)
+	if c == '{' {
+		e.state = emitObjectStart
+	} else {
+		e.state = emitArrayStart
+	}
+	return nil
+}
+
+// close ends the innermost container.
+func (e *emitter) close(c byte) error {
+	open := byte('[')
+	if c == '}' {
+		open = '{'
+	}
+	if len(e.stack) == 0 || e.stack[len(e.stack)-1] != open {
+		return e.unexpected(c)
+	}
+	switch e.state {
+	case emitObjectStart, emitArrayStart:
+		if e.hasQueuedComments() {
+			e.writeComments(len(e.stack))
+			e.newline(len(e.stack) - 1)
+		}
+	case emitAfterValue:
+		e.writeComments(len(e.stack))
+		e.newline(len(e.stack) - 1)
+	default:
+		return e.unexpected(c)
+	}
+	if err := e.token(); err != nil {
+		return err
+	}
+	e.out = append(e.out, c)
+	e.stack = e.stack[:len(e.stack)-1]
+	e.counts = e.counts[:len(e.counts)-1]
+	e.endValue()
+	return nil
+}
+
+func (e *emitter) colon() error {
+	if e.state != emitColon {
+		return e.unexpected(':')
+	}
+	if err := e.token(); err != nil {
+		return err
+	}
+	e.out = append(e.out, ':')
+	if e.pretty {
+		e.out = append(e.out, ' ')
+	}
+	e.state = emitMemberValue
+	return nil
+}
+
+func (e *emitter) comma() error {
+	if e.state != emitAfterValue {
+		return e.unexpected(',')
+	}
+	if err := e.token(); err != nil {
+		return err
+	}
+	if e.stack[len(e.stack)-1] == '{' {
+		e.state = emitObjectKey
+	} else {
+		e.state = emitArrayValue
+	}
+	return nil
+}
+
+// finish checks that a complete value was written and terminates the output.
+func (e *emitter) finish() error {
+	if e.state != emitDone {
+		return &emitError{reason: reasonEndOfInput, eof: true}
+	}
+	e.writeComments(0)
+	e.out = append(e.out, '\n')
+	return nil
+}
+
+// unexpected describes a token starting with found that is not allowed in
+// the current state, using the wording of describeParseError.
+func (e *emitter) unexpected(found byte) error {
+	if e.discard {
+		return errDiscardedInvalid
+	}
+	var reason string
+	switch e.state {
+	case emitColon:
+		reason = "expected ':' after object key"
+	case emitObjectStart, emitObjectKey:
+		reason = "expected string object key"
+	case emitAfterValue:
+		if e.stack[len(e.stack)-1] == '{' {
+			reason = "expected ',' or '}' after object member"
+		} else {
+			reason = "expected ',' or ']' after array element"
+		}
+	case emitDone:
+		reason = reasonTrailing
+	default:
+		reason = "expected a value"
+	}
+	if found < utf8.RuneSelf {
+		reason += ", found " + strconv.QuoteRune(rune(found))
+	}
+	return &emitError{reason: reason}
+}
+
+// appendReencodedString decodes the JSON string lexeme raw and appends it to
+// dst encoded like encoding/json. scratch is reused for decoded text.
+func appendReencodedString(dst, scratch, raw []byte) ([]byte, []byte, error) {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return dst, scratch, &emitError{reason: reasonEndOfInput, eof: true}
+	}
+	body := raw[1 : len(raw)-1]
+	text := body
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c < 0x20 {
+			return dst, scratch, &emitError{reason: "invalid character in string, found " + strconv.QuoteRune(rune(c))}
+		}
+		if c == '\\' {
+			var err error
+			if scratch, err = unquoteJSONString(scratch[:0], body); err != nil {
+				return dst, scratch, err
+			}
+			text = scratch
+			break
+		}
+	}
+	return appendJSONString(dst, text), scratch, nil
+}
+
+// checkJSONString reports the error appendReencodedString would return for
+// raw without decoding it.
+func checkJSONString(raw []byte) error {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return &emitError{reason: reasonEndOfInput, eof: true}
+	}
+	body := raw[1 : len(raw)-1]
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c < 0x20 {
+			return &emitError{reason: "invalid character in string, found " + strconv.QuoteRune(rune(c))}
+		}
+		if c != '\\' {
+			continue
+		}
+		if i+1 >= len(body) {
+			return &emitError{reason: "invalid escape in string"}
+		}
+		switch body[i+1] {
+		case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			i++
+		case 'u':
+			if _, ok := hex4(body, i+2); !ok {
+				return &emitError{reason: "invalid escape in string"}
+			}
+			i += 5
+		default:
+			return &emitError{reason: "invalid escape in string"}
+		}
+	}
+	return nil
+}
+
+// unquoteJSONString decodes the body of a JSON string literal. Unpaired
+// surrogates and invalid UTF-8 become U+FFFD, like encoding/json.
+func unquoteJSONString(dst, body []byte) ([]byte, error) {
+	for i := 0; i < len(body); {
+		c := body[i]
+		if c < 0x20 {
+			return dst, &emitError{reason: "invalid character in string, found " + strconv.QuoteRune(rune(c))}
+		}
+		if c != '\\' {
+			if c < utf8.RuneSelf {
+				dst = append(dst, c)
+				i++
+				continue
+			}
+			r, sz := utf8.DecodeRune(body[i:])
+			dst = utf8.AppendRune(dst, r)
+			i += sz
+			continue
+		}
+		if i+1 >= len(body) {
+			return dst, &emitError{reason: "invalid escape in string"}
+		}
+		switch body[i+1] {
+		case '"', '\\', '/':
+			dst = append(dst, body[i+1])
+		case 'b':
+			dst = append(dst, '\b')
+		case 'f':
+			dst = append(dst, '\f')
+		case 'n':
+			dst = append(dst, '\n')
+		case 'r':
+			dst = append(dst, '\r')
+		case 't':
+			dst = append(dst, '\t')
+		case 'u':
+			r, ok := hex4(body, i+2)
+			if !ok {
+				return dst, &emitError{reason: "invalid escape in string"}
+			}
+			i += 6
+			if utf16.IsSurrogate(r) {
+				r2, ok := rune(0), false
+				if i+1 < len(body) && body[i] == '\\' && body[i+1] == 'u' {
+					r2, ok = hex4(body, i+2)
+				}
+				if dec := utf16.DecodeRune(r, r2); ok && dec != utf8.RuneError {
+					i += 6
+					r = dec
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			dst = utf8.AppendRune(dst, r)
+			continue
+		default:
+			return dst, &emitError{reason: "invalid escape in string"}
+		}
+		i += 2
+	}
+	return dst, nil
+}
+
+func hex4(b []byte, i int) (rune, bool) {
+	if i+4 > len(b) {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[i : i+4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
+
+const hexLower = "0123456789abcdef"
+
+// appendJSONString appends s as a JSON string with the escaping rules of
+// encoding/json, including HTML-safe escapes for '<', '>' and '&'. Invalid
+// UTF-8 becomes U+FFFD, as it would after a decode and re-encode.
+func appendJSONString(dst, s []byte) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexLower[c>>4], hexLower[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, sz := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && sz == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\uFFFD"...)
+			i++
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexLower[r&0xF])
+			i += sz
+			start = i
+			continue
+		}
+		i += sz
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// isJSONNumber reports whether b is a complete JSON number literal.
+func isJSONNumber(b []byte) bool {
+	i := 0
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+	if i >= len(b) {
+		return false
+	}
+	if b[i] == '0' {
+		i++
+	} else if b[i] >= '1' && b[i] <= '9' {
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+	} else {
+		return false
+	}
+	if i < len(b) && b[i] == '.' {
+		i++
+		if i >= len(b) || b[i] < '0' || b[i] > '9' {
+			return false
+		}
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			i++
+		}
+		if i >= len(b) || b[i] < '0' || b[i] > '9' {
+			return false
+		}
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+	}
+	return i == len(b)
+}
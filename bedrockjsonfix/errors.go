@@ -3,12 +3,45 @@ package bedrockjsonfix
 import "errors"
 
 var (
-	ErrInputTooLarge   = errors.New("input too large")
-	ErrOutputTooLarge  = errors.New("output too large")
-	ErrNoRootFound     = errors.New("no json root found")
-	ErrInvalidJSON     = errors.New("invalid json")
-	ErrOptionsInvalid  = errors.New("invalid options")
-	ErrContextCanceled = errors.New("context canceled")
+	ErrInputTooLarge    = errors.New("input too large")
+	ErrOutputTooLarge   = errors.New("output too large")
+	ErrNoRootFound      = errors.New("no json root found")
+	ErrInvalidJSON      = errors.New("invalid json")
+	ErrOptionsInvalid   = errors.New("invalid options")
+	ErrContextCanceled  = errors.New("context canceled")
+	ErrRepairTooLossy   = errors.New("repair too lossy")
+	ErrRepairDisallowed = errors.New("repair disallowed")
+
+	// ErrStreamUnsupported reports options that FixStream cannot honor.
+	ErrStreamUnsupported = errors.New("option unsupported when streaming")
+	// ErrTokenTooLarge reports a token that does not fit the stream window.
+	ErrTokenTooLarge = errors.New("token exceeds stream window")
+	// ErrLimitExceeded reports input beyond a structural limit such as
+	// Options.MaxDepth. FixError.Limit names the limit.
+	ErrLimitExceeded = errors.New("structural limit exceeded")
+	// ErrStageFailed reports an error returned by a custom Stage.
+	ErrStageFailed = errors.New("custom stage failed")
+	// ErrRulesInvalid reports a rule file that cannot be compiled.
+	ErrRulesInvalid = errors.New("invalid repair rules")
+	// ErrInvalidPointer reports a JSON Pointer that is malformed or does not
+	// resolve in a Tree.
+	ErrInvalidPointer = errors.New("invalid json pointer")
+	// ErrUnmarshal reports repaired JSON that does not fit the Go value
+	// passed to Unmarshal.
+	ErrUnmarshal = errors.New("cannot unmarshal into go value")
+	// ErrTransportDecode reports a data: URL whose payload does not decode.
+	ErrTransportDecode = errors.New("cannot decode transport encoding")
+)
+
+// Pipeline stage names reported in FixError.Stage.
+const (
+	StageDecode          = "decode"
+	StageCleanup         = "cleanup"
+	StageTrimToFirstRoot = "trim_to_first_root"
+	StageParse           = "parse"
+	StageRootScan        = "root_scan"
+	StageUnmarshal       = "unmarshal"
+	StageTransport       = "transport"
 )
 
 // FixError provides stable error coding and wrapped causes.
@@ -16,6 +49,22 @@ type FixError struct {
 	Code    string
 	Message string
 	Cause   error
+
+	// Position locates the failure in the original input. Line is zero when
+	// the error has no meaningful position.
+	Position
+	// Snippet is the offending input line followed by a caret line.
+	Snippet string
+	// Reason is a short description of the failure, such as "expected ',' or '}' after object member".
+	Reason string
+	// Stage names the pipeline stage that produced the error.
+	Stage string
+	// Candidate is the root candidate that produced the error: 0 for the
+	// primary candidate and n for the n-th root scan attempt.
+	Candidate int
+	// Limit names the Options field, such as "MaxDepth", of an
+	// ErrLimitExceeded error.
+	Limit string
 }
 
 func (e *FixError) Error() string { return e.Code + ": " + e.Message }
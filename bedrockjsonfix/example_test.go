@@ -19,3 +19,24 @@ func ExampleFixBytes_report() {
 	)
 	// Output: line_comments=1 trailing_commas=1 valid=true
 }
+
+func ExampleScanner() {
+	s := bedrockjsonfix.NewScanner([]byte("{\"a\": 1, // note\n}"), bedrockjsonfix.DefaultOptions())
+	for {
+		tok := s.Next()
+		if tok.Kind == bedrockjsonfix.TokenEOF {
+			break
+		}
+		if tok.Kind != bedrockjsonfix.TokenWhitespace {
+			fmt.Printf("%d:%d %s %q\n", tok.Start.Line, tok.Start.Column, tok.Kind, tok.Text)
+		}
+	}
+	// Output:
+	// 1:1 punct "{"
+	// 1:2 string "\"a\""
+	// 1:5 punct ":"
+	// 1:7 number "1"
+	// 1:8 punct ","
+	// 1:10 comment "// note"
+	// 2:1 punct "}"
+}
@@ -1,6 +1,9 @@
 package bedrockjsonfix
 
+import "bytes"
+
 // ExtractFirstJSONValue returns the [start,end) region containing first complete root JSON object/array.
+// The options are not used; input is scanned as it is, without repairs or limits.
 func ExtractFirstJSONValue(input []byte, _ Options) (start, end int, kind RootKind, rep Report, err error) {
 	s := firstRootStartOutsideStrings(input, 0)
 	if s < 0 {
@@ -49,3 +52,112 @@ func ExtractFirstJSONValue(input []byte, _ Options) (start, end int, kind RootKi
 	}
 	return 0, 0, RootUnknown, rep, &FixError{Code: "no_root", Message: "incomplete JSON root", Cause: ErrNoRootFound}
 }
+
+// defaultExtractMinBytes is the ExtractMinBytes used when it is zero. It
+// skips footnote markers such as "[1]" or "[12]".
+const defaultExtractMinBytes = 6
+
+// Extracted is a JSON value ExtractAll found in text.
+type Extracted struct {
+	// Start and End delimit the value in the text, [Start,End).
+	Start, End int
+	// Result is the repaired value. Result.Offset is Start.
+	Result Result
+	// Confidence estimates, from 0 to 1, that the span was meant as JSON:
+	// 1 for valid JSON, less the riskier the repairs and the more junk was
+	// dropped.
+	Confidence float64
+}
+
+// ExtractAll finds every object or array embedded in text, such as JSON
+// pasted into prose, and repairs each with opt. Values are reported in text
+// order and never overlap: a value nested in a reported one is part of it,
+// while the values inside a span that cannot be repaired are tried on their
+// own. A span runs to where its brackets balance, or to a line starting with
+// '{' or '[' after an unclosed value, as in Decoder.
+//
+// Spans shorter than opt.ExtractMinBytes are skipped, and so are values that
+// are implausible as JSON: empty containers, which is what bracketed prose
+// repairs to, and values that kept fewer bytes than were dropped as junk.
+// Root scanning is not used, since inner values are candidates themselves.
+// Brackets in strings and comments outside values do not start one.
+//
+// text must fit in opt.MaxInputBytes. The work spent on the values inside
+// failed spans is bounded by a few times the length of text, so text with
+// many unbalanced brackets takes linear time; once it is spent, a span that
+// cannot be repaired is skipped as a whole.
+func ExtractAll(text []byte, opt Options) ([]Extracted, error) {
+	opt.RootPolicy = RootPolicyFirst
+	f, err := NewFixer(opt)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(text)) > opt.MaxInputBytes {
+		return nil, inputTooLargeError(int64(len(text)), opt.MaxInputBytes)
+	}
+	minBytes := opt.ExtractMinBytes
+	if minBytes == 0 {
+		minBytes = defaultExtractMinBytes
+	}
+	var found []Extracted
+	budget := extractWorkFactor * len(text)
+	for i := 0; i < len(text); {
+		start, _, _ := documentStart(text, i, true)
+		if start < 0 {
+			break
+		}
+		end, ok := documentEnd(text, start, true)
+		budget -= end - start
+		if ok && end-start >= minBytes {
+			budget -= end - start
+			_, res, err := f.Fix(nil, text[start:end])
+			if c := extractConfidence(res); err == nil && c > 0 && !emptyContainer(res.Output) {
+				res.Offset = int64(start)
+				found = append(found, Extracted{Start: start, End: end, Result: res, Confidence: c})
+				i = end
+				continue
+			}
+		}
+		if budget < 0 {
+			i = end
+			continue
+		}
+		i = start + 1
+	}
+	return found, nil
+}
+
+// extractWorkFactor bounds the bytes ExtractAll scans and repairs, as a
+// multiple of the length of the text.
+const extractWorkFactor = 8
+
+// extractConfidence scores a repaired value, or returns 0 when at least as
+// many bytes were dropped as junk as the value kept.
+func extractConfidence(res Result) float64 {
+	rep := res.Report
+	junk := rep.DroppedJunkOutsideStrings + rep.TrimmedLeadingJunkBytes + rep.TrimmedTrailingJunkBytes
+	kept := 0
+	for _, c := range res.Output {
+		if !isSpace(c) {
+			kept++
+		}
+	}
+	if junk >= kept {
+		return 0
+	}
+	c := 1.0
+	switch rep.Risk {
+	case RiskCosmetic:
+		c = 0.9
+	case RiskStructural:
+		c = 0.75
+	case RiskLossy:
+		c = 0.5
+	}
+	return c * float64(kept) / float64(kept+junk)
+}
+
+func emptyContainer(out []byte) bool {
+	out = bytes.TrimSpace(out)
+	return len(out) >= 2 && len(bytes.TrimSpace(out[1:len(out)-1])) == 0
+}
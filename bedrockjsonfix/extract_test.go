@@ -0,0 +1,82 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExtractAll(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty = false
+	text := "Hi, my manifest {\"a\":1} fails [see 1] and so does\n" +
+		"this one:\n{\"b\": [1, 2,], // c\n\"n\": {\"x\": 1}}\nand {oops [\"p\", \"q\"]} too. [1] {} {\"broken\n"
+	got, err := ExtractAll([]byte(text), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		span   string
+		output string
+	}{
+		{`{"a":1}`, `{"a":1}`},
+		{"{\"b\": [1, 2,], // c\n\"n\": {\"x\": 1}}", `{"b":[1,2],"n":{"x":1}}`},
+		{`["p", "q"]`, `["p", "q"]`},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d values: %+v", len(got), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if span := text[g.Start:g.End]; span != w.span {
+			t.Fatalf("value %d span = %q, want %q", i, span, w.span)
+		}
+		if out := string(g.Result.Output); out != w.output && out != w.output+"\n" {
+			t.Fatalf("value %d output = %q, want %q", i, out, w.output)
+		}
+		if g.Result.Offset != int64(g.Start) {
+			t.Fatalf("value %d offset = %d, want %d", i, g.Result.Offset, g.Start)
+		}
+	}
+	if got[0].Confidence != 1 || got[2].Confidence != 1 {
+		t.Fatalf("valid JSON confidence = %v, %v, want 1", got[0].Confidence, got[2].Confidence)
+	}
+	if c := got[1].Confidence; c <= 0.5 || c >= 1 {
+		t.Fatalf("repaired value confidence = %v", c)
+	}
+}
+
+func TestExtractAllFilters(t *testing.T) {
+	opt := DefaultOptions()
+	text := []byte(`ref [12], {x}, [a b c d e f 1], "a {string}" // and {a comment}
+{"k":"v"}`)
+	got, err := ExtractAll(text, opt)
+	if err != nil || len(got) != 1 || string(text[got[0].Start:got[0].End]) != `{"k":"v"}` {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+	opt.ExtractMinBytes = 1
+	if got, _ := ExtractAll([]byte("ref [12]"), opt); len(got) != 1 {
+		t.Fatalf("with ExtractMinBytes 1 got %+v", got)
+	}
+	opt.ExtractMinBytes = -1
+	if got, err := ExtractAll(text, opt); got != nil || !errors.Is(err, ErrOptionsInvalid) {
+		t.Fatalf("invalid options got %+v, %v", got, err)
+	}
+}
+
+func TestExtractAllLimits(t *testing.T) {
+	opt := DefaultOptions()
+	opt.MaxInputBytes = 8
+	if _, err := ExtractAll([]byte(`{"a":1} {"b":2}`), opt); !errors.Is(err, ErrInputTooLarge) {
+		t.Fatalf("error = %v, want ErrInputTooLarge", err)
+	}
+
+	// Every '{' starts a span that fails and holds all the others. Retrying
+	// each of them would repair O(n^2) bytes.
+	opt = DefaultOptions()
+	text := []byte(`{"a":1} ` + strings.Repeat("{x ", 1<<16) + strings.Repeat("}", 1<<16))
+	got, err := ExtractAll(text, opt)
+	if err != nil || len(got) != 1 || got[0].Start != 0 {
+		t.Fatalf("got %d values, %v", len(got), err)
+	}
+}
@@ -1,14 +1,20 @@
 package bedrockjsonfix
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"unicode/utf8"
 )
 
 const readerChunkSize = 32 << 10
 
+// cancelCheckBytes is how much input a CPU-bound pass scans between checks
+// of its context.
+const cancelCheckBytes = 64 << 10
+
 var errRootRejected = errors.New("root rejected by validator")
 
 func contextCanceledError() *FixError {
@@ -56,13 +62,30 @@ func readAllWithContext(ctx context.Context, r io.Reader, maxInputBytes int64) (
 	}
 }
 
-func parseCandidate(raw []byte, opt Options) ([]byte, RootKind, error) {
-	out, kind, parsed, err := parseAndMarshalWithParsed(raw, opt)
+func parseCandidate(ctx context.Context, dst, raw []byte, opt Options, sc *fixScratch) ([]byte, RootKind, error) {
+	var (
+		out  = dst
+		kind RootKind
+		err  error
+	)
+	if sc != nil && sc.lint != nil && !opt.Pretty && maxCompactOutput(len(raw)) <= opt.MaxOutputBytes {
+		// Lint only needs the outcome, and MaxOutputBytes cannot be
+		// reached.
+		kind, err = checkDocument(ctx, raw, opt, sc)
+	} else {
+		out, kind, err = emitDocument(ctx, dst, raw, opt, sc)
+	}
 	if err != nil {
 		return nil, RootUnknown, err
 	}
-	if !acceptRootCandidate(opt, kind, raw, parsed) {
-		return nil, RootUnknown, errRootRejected
+	if opt.RootValidator != nil {
+		parsed, err := decodeTree(raw)
+		if err != nil {
+			return nil, RootUnknown, err
+		}
+		if !acceptRootCandidate(opt, kind, raw, parsed) {
+			return nil, RootUnknown, errRootRejected
+		}
 	}
 	return out, kind, nil
 }
@@ -104,82 +127,237 @@ func FixReader(ctx context.Context, r io.Reader, opt Options) (Result, error) {
 	if err != nil {
 		return Result{}, err
 	}
-	return FixBytes(data, opt)
+	return FixBytesContext(ctx, data, opt)
 }
 
 // FixBytes normalizes tolerant JSON-ish bytes into strict JSON.
 func FixBytes(input []byte, opt Options) (Result, error) {
+	return FixBytesContext(context.Background(), input, opt)
+}
+
+// FixBytesContext is FixBytes that stops with ErrContextCanceled once ctx is
+// done. The cleanup and parse passes poll ctx as they scan, and root scanning
+// checks it before every attempt.
+func FixBytesContext(ctx context.Context, input []byte, opt Options) (Result, error) {
 	if err := opt.Validate(); err != nil {
 		return Result{}, err
 	}
+	_, res, err := fixBytes(ctx, nil, input, opt, nil)
+	return res, err
+}
+
+func outputTooLargeError(size int, limit int64) *FixError {
+	return &FixError{Code: "output_too_large", Message: fmt.Sprintf("output exceeds limit (%d > %d)", size, limit), Cause: ErrOutputTooLarge}
+}
+
+// fixBytes is FixBytes for validated options. It appends the output to dst
+// and sets Result.Output to the appended bytes. sc may be nil; when set, its
+// buffers are reused and none of them is referenced by the result.
+func fixBytes(ctx context.Context, dst, input []byte, opt Options, sc *fixScratch) ([]byte, Result, error) {
+	if ctx.Err() != nil {
+		return dst, Result{}, contextCanceledError()
+	}
+	if sc == nil {
+		sc = &fixScratch{}
+	}
 	if int64(len(input)) > opt.MaxInputBytes {
-		return Result{}, inputTooLargeError(int64(len(input)), opt.MaxInputBytes)
+		return dst, Result{}, inputTooLargeError(int64(len(input)), opt.MaxInputBytes)
+	}
+
+	src := input
+	var (
+		rep  Report
+		junk junkTally
+	)
+	if opt.DecodeTransport {
+		decoded, chain, err := decodeTransport(input, opt.MaxInputBytes)
+		if err != nil {
+			return dst, Result{}, err
+		}
+		// Positions refer to the decoded bytes from here on.
+		input = decoded
+		if len(chain) > 0 {
+			rep.editLists().transport = chain
+		}
+	}
+	lint := sc.lint
+	if lint != nil {
+		lint.input = input
+	}
+	trace := &sc.trace
+	trace.reset()
+	body := input
+	if opt.effectiveFixes()&RepairStringJSON != 0 {
+		body, rep.UnwrappedStringLayers = unwrapStringJSON(input, trace)
 	}
 
-	if opt.PreserveIfValid {
-		if ok, root := strictJSONSingleDocument(input); ok {
-			if int64(len(input)) > opt.MaxOutputBytes {
-				return Result{}, &FixError{Code: "output_too_large", Message: fmt.Sprintf("output exceeds limit (%d > %d)", len(input), opt.MaxOutputBytes), Cause: ErrOutputTooLarge}
+	if opt.PreserveIfValid && len(opt.Stages) == 0 {
+		ok, root, err := validDocument(body, opt, sc)
+		if ee, limited := asLimitError(err); limited {
+			return dst, Result{}, limitErrorAt(input, trace.origin(ee.offset), ee)
+		}
+		if ok {
+			// Unwrapping a string is the only repair that can precede
+			// this path.
+			classifyRepairs(&rep, junkTally{})
+			if err := checkRisk(rep, junkTally{}, opt); err != nil {
+				return dst, Result{}, err
+			}
+			if int64(len(body)) > opt.MaxOutputBytes {
+				return dst, Result{}, outputTooLargeError(len(body), opt.MaxOutputBytes)
 			}
-			res := Result{Output: append([]byte(nil), input...), Root: root}
+			out := dst
+			if lint == nil {
+				out = append(out, body...)
+			}
+			res := Result{Output: out[len(dst):], Root: root, Report: rep, Warnings: warningsFromReport(rep)}
 			res.Report.ValidJSON = true
-			return res, nil
+			if opt.BuildSourceMap {
+				res.SourceMap = buildSourceMap(input, body, res.Output, trace)
+			}
+			return out, res, nil
 		}
 	}
 
-	var rep Report
+	fixes := opt.effectiveFixes()
+	raw := body
+	if fixes&RepairMarkdown != 0 {
+		raw, rep.Markdown = unwrapMarkdown(raw, trace)
+	}
+	raw, err := runStages(raw, opt, slotBeforeDecode, slotBeforeDecode, &rep, trace)
+	if err != nil {
+		return dst, Result{}, err
+	}
 	decodeOpt := opt
-	if opt.Mode == ModeStrict {
-		decodeOpt.AllowCP1252Fallback = false
+	decodeOpt.AllowCP1252Fallback = fixes&RepairCP1252 != 0
+	if lint != nil && !utf8.Valid(raw) {
+		off := firstInvalidUTF8(raw)
+		lint.add(lintInvalidUTF8, off, off+1)
+		lint.mapTo(lint.len()-1, trace, trace.len())
 	}
-	decoded, err := decodeInput(input, decodeOpt, &rep)
+	decoded, err := decodeInput(raw, decodeOpt, &rep, trace.pass())
 	if err != nil {
-		return Result{}, err
+		return dst, Result{}, err
+	}
+	if fixes&RepairCodeWrapper != 0 {
+		// A BOM before the wrapper goes with it, but is still a BOM repair.
+		bom := fixes&RepairBOM != 0 && bytes.HasPrefix(decoded, []byte("\xEF\xBB\xBF"))
+		beforeUnwrap := trace.len()
+		if decoded, rep.CodeWrapper = unwrapCode(decoded, bom, trace); rep.CodeWrapper != "" && bom {
+			rep.RemovedBOM++
+			if lint != nil {
+				lint.add(lintBOM, 0, 3)
+				lint.mapTo(lint.len()-1, trace, beforeUnwrap)
+			}
+		}
+	}
+	if decoded, err = runStages(decoded, opt, slotAfterDecode, slotBeforeCleanup, &rep, trace); err != nil {
+		return dst, Result{}, err
 	}
 
 	rootKind := RootUnknown
 	candidate := decoded
 	if opt.Mode == ModeStrict {
-		out, kind, parseErr := parseAndMarshal(candidate, opt)
+		if candidate, err = runStages(candidate, opt, slotAfterSanitize, slotAfterCleanup, &rep, trace); err != nil {
+			return dst, Result{}, err
+		}
+		out, kind, parseErr := emitDocument(ctx, dst, candidate, opt, sc)
+		if errors.Is(parseErr, ErrContextCanceled) {
+			return dst, Result{}, parseErr
+		}
+		if ee, ok := asLimitError(parseErr); ok {
+			return dst, Result{}, limitErrorAt(input, trace.origin(parseErrorOffset(candidate, ee)), ee)
+		}
 		if parseErr != nil {
-			return Result{}, &FixError{Code: "invalid_json", Message: "strict mode requires a valid single JSON document", Cause: errors.Join(ErrInvalidJSON, parseErr)}
+			return dst, Result{}, invalidJSONError(input, trace.origin(parseErrorOffset(candidate, parseErr)), parseErr, StageParse, 0)
 		}
-		if int64(len(out)) > opt.MaxOutputBytes {
-			return Result{}, &FixError{Code: "output_too_large", Message: fmt.Sprintf("output exceeds limit (%d > %d)", len(out), opt.MaxOutputBytes), Cause: ErrOutputTooLarge}
+		if int64(len(out)-len(dst)) > opt.MaxOutputBytes {
+			return dst, Result{}, outputTooLargeError(len(out)-len(dst), opt.MaxOutputBytes)
 		}
 		rep.ValidJSON = true
-		return Result{Output: out, Root: kind, Report: rep}, nil
+		res := Result{Output: out[len(dst):], Root: kind, Report: rep}
+		if opt.BuildSourceMap {
+			res.SourceMap = buildSourceMap(input, candidate, res.Output, trace)
+		}
+		return out, res, nil
 	}
 
-	clean := sanitize(decoded, opt, &rep)
-	if opt.EscapeStringControls {
-		clean = escapeStringControls(clean, &rep)
+	if opt.Output == OutputJSONC {
+		defer sc.jsonc.release()
+	}
+	if hasStages(opt, slotAfterSanitize, slotBeforeStrip) {
+		beforeSanitize := trace.len()
+		if decoded, err = sanitize(ctx, decoded, opt, &rep, trace.pass(), sc); err != nil {
+			return dst, Result{}, err
+		}
+		if lint != nil {
+			lint.mapTo(lint.mapped, trace, beforeSanitize)
+		}
+		if decoded, err = runStages(decoded, opt, slotAfterSanitize, slotBeforeStrip, &rep, trace); err != nil {
+			return dst, Result{}, err
+		}
+	}
+	beforeCleanup := trace.len()
+	cl, err := cleanup(ctx, decoded, opt, &rep, trace.pass(), sc)
+	if err != nil {
+		return dst, Result{}, err
+	}
+	if lint != nil {
+		lint.mapTo(lint.mapped, trace, beforeCleanup)
+	}
+	if notes := &sc.jsonc; len(notes.list) > 0 {
+		for i := range notes.list {
+			notes.list[i].origin = trace.originBefore(beforeCleanup, notes.list[i].origin)
+		}
+		notes.trace, notes.base = trace, 0
+	}
+	if hasStages(opt, slotAfterCleanup, slotAfterCleanup) {
+		staged, err := runStages(cl.out, opt, slotAfterCleanup, slotAfterCleanup, &rep, trace)
+		if err != nil {
+			return dst, Result{}, err
+		}
+		if !sameBytes(staged, cl.out) {
+			cl.out = staged
+			cl.rootStart, cl.rootEnd, cl.rootKind = locateRoot(staged)
+		}
+	}
+	candidate = cl.out
+	rootStart, rootEnd := cl.rootStart, cl.rootEnd
+	if fixes&RepairLeadingJunk != 0 {
+		if rootStart < 0 {
+			return dst, Result{}, &FixError{Code: "no_root", Message: "no JSON root object/array found", Cause: ErrNoRootFound, Stage: StageTrimToFirstRoot}
+		}
+		rep.TrimmedLeadingJunkBytes += rootStart
+		junk.leading += nonSpaceBytes(candidate[:rootStart])
+		lint.trimmed(candidate, 0, rootStart, true, trace)
+		candidate = candidate[rootStart:]
+		trace.shift(rootStart)
+		rootEnd -= rootStart
+		rootStart = 0
 	}
-	clean = normalizeLiteralNewlinesInStrings(clean, &rep)
-	clean = stripComments(clean, &rep)
-	clean = removeTrailingCommas(clean, &rep)
-	candidate = clean
-	isBedrockMode := opt.Mode == ModeBedrock || opt.Mode == ModeBedrockSafe
 	scanCandidate := candidate
-	scanRep := rep
-	if isBedrockMode {
-		if opt.TrimToFirstRoot {
-			i := firstRootStartOutsideStrings(candidate, 0)
-			if i < 0 {
-				return Result{}, &FixError{Code: "no_root", Message: "no JSON root object/array found", Cause: ErrNoRootFound}
-			}
-			rep.TrimmedLeadingJunkBytes += i
-			candidate = candidate[i:]
-		}
-		if opt.DropJunkOutsideStrings {
-			candidate = dropUnknownOutsideStrings(candidate, &rep)
-		}
-		scanCandidate = candidate
-		scanRep = rep
-		if opt.TrimAfterFirstRoot {
+	scanRep, scanJunk := rep, junk
+	scanTrace, scanLint := trace.len(), lint.len()
+	if fixes&RepairTrailingJunk != 0 {
+		// Data before the root is left to RepairLeadingJunk, so that a
+		// disabled leading-junk repair still fails the parse.
+		if rootEnd >= 0 {
+			rep.TrimmedTrailingJunkBytes += len(candidate) - rootEnd
+			junk.trailing += nonSpaceBytes(candidate[rootEnd:])
+			lint.trimmed(candidate, rootEnd, len(candidate), false, trace)
+			candidate = candidate[:rootEnd]
+			rootKind = cl.rootKind
+		} else {
 			trimmed, kind, er, ok := trimAfterFirstRootCandidate(candidate, opt)
-			mergeReport(&rep, er)
+			if ok && fixes&RepairLeadingJunk == 0 && nonSpaceBytes(candidate[:er.TrimmedLeadingJunkBytes]) > 0 {
+				ok = false
+			}
 			if ok {
+				mergeReport(&rep, er)
+				junk.trim(candidate, er)
+				lint.trimmed(candidate, 0, er.TrimmedLeadingJunkBytes, true, trace)
+				lint.trimmed(candidate, len(candidate)-er.TrimmedTrailingJunkBytes, len(candidate), false, trace)
+				trace.shift(er.TrimmedLeadingJunkBytes)
 				candidate = trimmed
 				if kind != RootUnknown {
 					rootKind = kind
@@ -192,20 +370,34 @@ func FixBytes(input []byte, opt Options) (Result, error) {
 		out      []byte
 		kind     RootKind
 		parseErr error
+
+		errAt      int
+		errStage   = StageParse
+		errAttempt int
 	)
-	if isBedrockMode {
-		out, kind, parseErr = parseCandidate(candidate, opt)
-	} else {
-		out, kind, parseErr = parseAndMarshal(candidate, opt)
+	out, kind, parseErr = parseCandidate(ctx, dst, candidate, opt, sc)
+	if errors.Is(parseErr, ErrContextCanceled) {
+		return dst, Result{}, parseErr
+	}
+	if ee, ok := asLimitError(parseErr); ok {
+		return dst, Result{}, limitErrorAt(input, trace.origin(parseErrorOffset(candidate, ee)), ee)
+	}
+	if parseErr != nil {
+		errAt = trace.origin(parseErrorOffset(candidate, parseErr))
 	}
-	if parseErr != nil && isBedrockMode && shouldScanAfterFailure(parseErr, opt, scanCandidate) {
-		rep = scanRep
+	if parseErr != nil && fixes&RepairRootScan != 0 && shouldScanAfterFailure(parseErr, opt, scanCandidate) {
+		rep, junk = scanRep, scanJunk
+		trace.truncate(scanTrace)
+		lint.truncate(scanLint)
 		rootKind = RootUnknown
 		rep.RootScanUsed = true
 		maxCandidates := opt.effectiveRootScanMaxCandidates()
 		scanFrom := 0
 		baseLeading := rep.TrimmedLeadingJunkBytes
 		for attempt := 1; attempt <= maxCandidates; attempt++ {
+			if ctx.Err() != nil {
+				return dst, Result{}, contextCanceledError()
+			}
 			next := nextRootCandidate(scanCandidate, scanFrom+1)
 			if next < 0 {
 				break
@@ -213,34 +405,62 @@ func FixBytes(input []byte, opt Options) (Result, error) {
 			rep.RootScanAttemptsUsed = attempt
 			scanFrom = next
 			rep.TrimmedLeadingJunkBytes = baseLeading + next
+			junk.leading = scanJunk.leading + nonSpaceBytes(scanCandidate[:next])
 			trimmed := scanCandidate[next:]
 			var trimRep Report
-			if opt.TrimAfterFirstRoot {
+			if fixes&RepairTrailingJunk != 0 {
 				var ok bool
 				trimmed, _, trimRep, ok = trimAfterFirstRootCandidate(trimmed, opt)
 				if !ok {
 					continue
 				}
 			}
-			out, kind, parseErr = parseCandidate(trimmed, opt)
+			sc.jsonc.base = next + trimRep.TrimmedLeadingJunkBytes
+			out, kind, parseErr = parseCandidate(ctx, dst, trimmed, opt, sc)
+			if errors.Is(parseErr, ErrContextCanceled) {
+				return dst, Result{}, parseErr
+			}
+			if ee, ok := asLimitError(parseErr); ok {
+				return dst, Result{}, limitErrorAt(input, trace.origin(next+trimRep.TrimmedLeadingJunkBytes+parseErrorOffset(trimmed, ee)), ee)
+			}
 			if parseErr == nil {
 				mergeReport(&rep, trimRep)
+				junk.trim(scanCandidate[next:], trimRep)
+				lint.trimmed(scanCandidate, 0, next+trimRep.TrimmedLeadingJunkBytes, true, trace)
+				lint.trimmed(scanCandidate, len(scanCandidate)-trimRep.TrimmedTrailingJunkBytes, len(scanCandidate), false, trace)
+				trace.shift(next + trimRep.TrimmedLeadingJunkBytes)
+				candidate = trimmed
 				break
 			}
+			errAt = trace.origin(next + trimRep.TrimmedLeadingJunkBytes + parseErrorOffset(trimmed, parseErr))
+			errStage = StageRootScan
+			errAttempt = attempt
 			if opt.RootPolicy == RootPolicyScanLeadingJunk && !errors.Is(parseErr, errRootRejected) && !isLikelyWrongRootStart(parseErr, opt.WrongStartMaxOffset) {
 				break
 			}
 		}
 	}
 	if parseErr != nil {
-		return Result{}, &FixError{Code: "invalid_json", Message: "unable to normalize into a valid single JSON document", Cause: errors.Join(ErrInvalidJSON, parseErr)}
+		if fe := disallowedRepairError(ctx, src, opt); fe != nil {
+			return dst, Result{}, fe
+		}
+		return dst, Result{}, invalidJSONError(input, errAt, parseErr, errStage, errAttempt)
 	}
-	if int64(len(out)) > opt.MaxOutputBytes {
-		return Result{}, &FixError{Code: "output_too_large", Message: fmt.Sprintf("output exceeds limit (%d > %d)", len(out), opt.MaxOutputBytes), Cause: ErrOutputTooLarge}
+	if int64(len(out)-len(dst)) > opt.MaxOutputBytes {
+		return dst, Result{}, outputTooLargeError(len(out)-len(dst), opt.MaxOutputBytes)
 	}
 	rep.ValidJSON = true
+	rep.KeptComments = len(sc.jsonc.list)
+	classifyRepairs(&rep, junk)
+	if err := checkRisk(rep, junk, opt); err != nil {
+		return dst, Result{}, err
+	}
 	if rootKind == RootUnknown {
 		rootKind = kind
 	}
-	return Result{Output: out, Root: rootKind, Report: rep}, nil
+	res := Result{Output: out[len(dst):], Root: rootKind, Report: rep, Warnings: warningsFromReport(rep)}
+	if opt.BuildSourceMap {
+		res.SourceMap = buildSourceMap(input, candidate, res.Output, trace)
+	}
+	return out, res, nil
 }
@@ -3,6 +3,7 @@ package bedrockjsonfix
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"math"
@@ -43,16 +44,19 @@ func TestStrictJSONSingleDocumentAllocatesNoHeap(t *testing.T) {
 	}
 }
 
-func TestSanitizeNoopReturnsInputSlice(t *testing.T) {
+func TestCleanupNoopReturnsInputSlice(t *testing.T) {
 	input := []byte(`{"name":"stone","values":[1,2,3]}`)
 	var rep Report
 
-	out := sanitize(input, DefaultOptions(), &rep)
-	if len(out) == 0 || &out[0] != &input[0] {
-		t.Fatal("expected no-op sanitize to reuse input slice")
+	cl, _ := cleanup(t.Context(), input, DefaultOptions(), &rep, nil, nil)
+	if len(cl.out) == 0 || &cl.out[0] != &input[0] {
+		t.Fatal("expected no-op cleanup to reuse input slice")
 	}
 	if rep != (Report{}) {
-		t.Fatalf("expected empty report for no-op sanitize, got %+v", rep)
+		t.Fatalf("expected empty report for no-op cleanup, got %+v", rep)
+	}
+	if cl.rootStart != 0 || cl.rootEnd != len(input) || cl.rootKind != RootObject {
+		t.Fatalf("unexpected root span [%d,%d) kind %v", cl.rootStart, cl.rootEnd, cl.rootKind)
 	}
 }
 
@@ -209,6 +213,70 @@ func TestFixReaderStopsWhenContextCanceledDuringRead(t *testing.T) {
 	}
 }
 
+// cancelAfterChecks reports cancellation from the n-th call to Err on, so a
+// test can stop a pass partway through.
+type cancelAfterChecks struct {
+	context.Context
+	n, calls int
+}
+
+func (c *cancelAfterChecks) Err() error {
+	c.calls++
+	if c.calls >= c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestFixBytesContextCanceledInsidePasses(t *testing.T) {
+	large := []byte("{\"items\": [" + strings.Repeat("{\"a\": 1, /* c */},\n", 1<<16) + "]}")
+	strict := DefaultOptions()
+	strict.Mode = ModeStrict
+	strict.PreserveIfValid = false
+	scan := DefaultOptions()
+	scan.TrimToFirstRoot = false
+	scan.RootPolicy = RootPolicyScanBestEffort
+
+	cases := []struct {
+		name  string
+		input []byte
+		opt   Options
+	}{
+		{"cleanup", large, DefaultOptions()},
+		{"emit", []byte("[" + strings.Repeat("1,", 1<<16) + "1]"), strict},
+		{"root scan", []byte("{{oops} {\"ok\":true}"), scan},
+	}
+	for _, tc := range cases {
+		// The first check is on entry; the second is inside the pass.
+		ctx := &cancelAfterChecks{Context: t.Context(), n: 2}
+		_, err := FixBytesContext(ctx, tc.input, tc.opt)
+		if !errors.Is(err, ErrContextCanceled) {
+			t.Fatalf("%s: expected ErrContextCanceled, got %v", tc.name, err)
+		}
+		if ctx.calls != 2 {
+			t.Fatalf("%s: expected the pass to stop at its first check, got %d checks", tc.name, ctx.calls)
+		}
+	}
+}
+
+func TestFixBytesContextMatchesFixBytes(t *testing.T) {
+	input := []byte("// c\n{\"a\": [1, 2,],}")
+	want, err := FixBytes(input, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FixBytesContext(t.Context(), input, DefaultOptions())
+	if err != nil || !bytes.Equal(got.Output, want.Output) {
+		t.Fatalf("FixBytesContext = %q, %v; want %q", got.Output, err, want.Output)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := FixBytesContext(ctx, input, DefaultOptions()); !errors.Is(err, ErrContextCanceled) {
+		t.Fatalf("expected ErrContextCanceled, got %v", err)
+	}
+}
+
 func TestFixReaderMaxInputBytesMaxInt64DoesNotOverflowLimit(t *testing.T) {
 	opt := DefaultOptions()
 	opt.MaxInputBytes = math.MaxInt64
@@ -542,3 +610,397 @@ func TestRootScanBestEffortCanRecoverAfterBalancedInvalidRoot(t *testing.T) {
 		t.Fatalf("expected trimmed trailing junk %d, got %d", len(" trailing"), res.Report.TrimmedTrailingJunkBytes)
 	}
 }
+
+func TestInvalidJSONErrorReportsInputPosition(t *testing.T) {
+	opt := DefaultOptions()
+	in := []byte("// header /* { */\n{\n  \"a\": 1, // one\n  \"b\": 2\n  \"c\": 3\n}")
+	_, err := FixBytes(in, opt)
+	var fe *FixError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected FixError, got %v", err)
+	}
+	if fe.Code != "invalid_json" || !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fe.Line != 5 || fe.Column != 3 {
+		t.Fatalf("expected line 5 column 3, got line %d column %d", fe.Line, fe.Column)
+	}
+	if in[fe.Offset] != '"' {
+		t.Fatalf("expected offset to point at the unexpected quote, got %q", in[fe.Offset])
+	}
+	if !strings.HasPrefix(fe.Reason, "expected ',' or '}'") {
+		t.Fatalf("unexpected reason: %q", fe.Reason)
+	}
+	if fe.Stage != StageParse || fe.Candidate != 0 {
+		t.Fatalf("unexpected stage/candidate: %q/%d", fe.Stage, fe.Candidate)
+	}
+	if want := "  \"c\": 3\n  ^"; fe.Snippet != want {
+		t.Fatalf("unexpected snippet:\n%s\nwant:\n%s", fe.Snippet, want)
+	}
+	if !strings.HasPrefix(fe.Message, "line 5, column 3: ") {
+		t.Fatalf("unexpected message: %q", fe.Message)
+	}
+}
+
+func TestInvalidJSONErrorReportsRootScanCandidate(t *testing.T) {
+	opt := DefaultOptions()
+	opt.TrimToFirstRoot = false
+	opt.TrimAfterFirstRoot = false
+	opt.DropJunkOutsideStrings = false
+	opt.RootPolicy = RootPolicyScanBestEffort
+	opt.RootScanMaxCandidates = 2
+	_, err := FixBytes([]byte("{{x} {\"a\" 1}"), opt)
+	var fe *FixError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected FixError, got %v", err)
+	}
+	if fe.Stage != StageRootScan || fe.Candidate != 1 {
+		t.Fatalf("expected root scan candidate 1, got %q/%d", fe.Stage, fe.Candidate)
+	}
+	if fe.Offset != 10 {
+		t.Fatalf("expected offset 10, got %d", fe.Offset)
+	}
+}
+
+func TestInvalidEncodingErrorReportsPosition(t *testing.T) {
+	opt := DefaultOptions()
+	opt.AllowCP1252Fallback = false
+	opt.PreserveIfValid = false
+	_, err := FixBytes([]byte("{\n\"a\":\"\x93\"}"), opt)
+	var fe *FixError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected FixError, got %v", err)
+	}
+	if fe.Code != "invalid_encoding" || fe.Stage != StageDecode || fe.Line != 2 || fe.Column != 6 {
+		t.Fatalf("unexpected error details: %+v", fe)
+	}
+}
+
+func TestWarningsForLossyRepairs(t *testing.T) {
+	opt := DefaultOptions()
+	opt.AggressiveWhitespace = true
+	in := []byte("note: {\"a\":\"x\u00a0y\", \"b\": 1 ~} {\"c\":\"\x93\"}")
+	res, err := FixBytes(in, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Severity{
+		WarnCP1252Fallback:        SeverityWarning,
+		WarnJunkDropped:           SeverityWarning,
+		WarnLeadingDataDiscarded:  SeverityWarning,
+		WarnTrailingDataDiscarded: SeverityWarning,
+	}
+	got := map[string]Severity{}
+	for _, w := range res.Warnings {
+		got[w.Code] = w.Severity
+		if w.Message == "" {
+			t.Fatalf("warning %q has no message", w.Code)
+		}
+	}
+	for code, sev := range want {
+		if got[code] != sev {
+			t.Fatalf("expected warning %q with severity %v, got %v (all: %+v)", code, sev, got[code], res.Warnings)
+		}
+	}
+}
+
+func TestWarningNBSPReplacedInStrings(t *testing.T) {
+	opt := DefaultOptions()
+	opt.AggressiveWhitespace = true
+	opt.PreserveIfValid = false
+	res, err := FixBytes([]byte("{\"a\":\"x\u00a0y\"}"), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0].Code != WarnNBSPReplacedInStrings {
+		t.Fatalf("expected nbsp warning, got %+v", res.Warnings)
+	}
+	if res.Report.ReplacedNBSPInStrings != 1 {
+		t.Fatalf("expected one NBSP replaced inside strings, got %d", res.Report.ReplacedNBSPInStrings)
+	}
+}
+
+func TestNoWarningsForCosmeticRepairs(t *testing.T) {
+	res, err := FixBytes([]byte("\xEF\xBB\xBF{// c\n\"a\":1,}"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 0 {
+		t.Fatalf("expected no warnings, got %+v", res.Warnings)
+	}
+}
+
+func TestNoWarningsForTrimmedWhitespace(t *testing.T) {
+	opt := DefaultOptions()
+	opt.PreserveIfValid = false
+	for _, in := range []string{"{\"a\":1}\n", "\n\t {\"a\":1}\r\n\n"} {
+		res, err := FixBytes([]byte(in), opt)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if len(res.Warnings) != 0 {
+			t.Fatalf("%q: expected no warnings, got %+v", in, res.Warnings)
+		}
+	}
+}
+
+func TestReportRiskClassifiesRepairs(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		risk Risk
+		has  Repair
+	}{
+		{"\xEF\xBB\xBF{\"a\":1}", RiskCosmetic, RepairBOM},
+		{"{// c\n\"a\":1}", RiskCosmetic, RepairLineComments},
+		{`{"a":1,}`, RiskStructural, RepairTrailingCommas},
+		{`{"a":1} {"b":2}`, RiskLossy, RepairTrailingJunk},
+		{`Note: {"a":1}`, RiskLossy, RepairLeadingJunk},
+		{`{"a":1 ~}`, RiskLossy, RepairDropJunk},
+	} {
+		res, err := FixBytes([]byte(tc.in), DefaultOptions())
+		if err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		if res.Report.Risk != tc.risk || res.Report.Repairs&tc.has == 0 {
+			t.Fatalf("%q: got risk %v repairs %v, want risk %v with %v", tc.in, res.Report.Risk, res.Report.Repairs, tc.risk, tc.has)
+		}
+	}
+}
+
+func TestMaxRiskRejectsLossyRepairs(t *testing.T) {
+	opt := DefaultOptions()
+	opt.MaxRisk = RiskStructural
+	if _, err := FixBytes([]byte(`{"a":1,}`), opt); err != nil {
+		t.Fatalf("structural repair should pass: %v", err)
+	}
+	_, err := FixBytes([]byte(`{"a":1} {"b":2}`), opt)
+	if !errors.Is(err, ErrRepairTooLossy) {
+		t.Fatalf("expected ErrRepairTooLossy, got %v", err)
+	}
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Code != "repair_too_lossy" || !strings.Contains(fe.Message, "trailing_junk") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestMaxDroppedJunkBytes(t *testing.T) {
+	opt := DefaultOptions()
+	opt.MaxDroppedJunkBytes = 4
+	if _, err := FixBytes([]byte(`ab {"a":1}`), opt); err != nil {
+		t.Fatalf("small junk should pass: %v", err)
+	}
+	_, err := FixBytes([]byte(`some long prefix {"a":1}`), opt)
+	if !errors.Is(err, ErrRepairTooLossy) {
+		t.Fatalf("expected ErrRepairTooLossy, got %v", err)
+	}
+}
+
+func TestTrimmedWhitespaceIsNotJunk(t *testing.T) {
+	opt := DefaultOptions()
+	opt.PreserveIfValid = false
+	opt.MaxRisk = RiskStructural
+	res, err := FixBytes([]byte("// c\n{\"a\":1,}\n"), opt)
+	if err != nil {
+		t.Fatalf("whitespace after the root should not be lossy: %v", err)
+	}
+	if res.Report.Repairs&(RepairLeadingJunk|RepairTrailingJunk) != 0 {
+		t.Fatalf("repairs = %v, want no junk trimming", res.Report.Repairs)
+	}
+
+	opt = DefaultOptions()
+	opt.MaxDroppedJunkBytes = 1
+	if _, err := FixBytes([]byte("{\"a\":1,}\n\n\n"), opt); err != nil {
+		t.Fatalf("trailing newlines should not count as dropped junk: %v", err)
+	}
+
+	res, err = FixBytes([]byte("  \n{\"a\":1,}"), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Report.Repairs&RepairLeadingJunk != 0 {
+		t.Fatalf("repairs = %v, want no leading_junk for whitespace", res.Report.Repairs)
+	}
+}
+
+func TestFixesDisallowedRepairIsNamed(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Fixes &^= RepairTrailingCommas
+	res, err := FixBytes([]byte("{// ok\n\"a\":1}"), opt)
+	if err != nil {
+		t.Fatalf("comments should still be stripped: %v", err)
+	}
+	if res.Report.StrippedLineComments != 1 {
+		t.Fatalf("expected stripped comment, got %+v", res.Report)
+	}
+
+	_, err = FixBytes([]byte("{// ok\n\"a\":1,\n}"), opt)
+	if !errors.Is(err, ErrRepairDisallowed) || !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("expected ErrRepairDisallowed, got %v", err)
+	}
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Code != "repair_disallowed" || !strings.Contains(fe.Message, "trailing_commas") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fe.Line != 2 || fe.Column != 6 {
+		t.Fatalf("expected line 2 column 6, got %d:%d", fe.Line, fe.Column)
+	}
+}
+
+func TestFixesLeadingJunkDisabledWithTrailingJunkEnabled(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Fixes = RepairsBedrock &^ (RepairLeadingJunk | RepairDropJunk)
+	for _, in := range []string{`Note: {"a":1}`, `Note: {"a":1} done`} {
+		_, err := FixString(in, opt)
+		var fe *FixError
+		if !errors.Is(err, ErrRepairDisallowed) || !errors.As(err, &fe) || !strings.Contains(fe.Message, "leading_junk") {
+			t.Fatalf("%q: expected leading_junk repair_disallowed, got %v", in, err)
+		}
+	}
+
+	res, err := FixString(" \n{\"a\":1} done", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Output) != "{\n  \"a\": 1\n}\n" || res.Report.Repairs != RepairTrailingJunk {
+		t.Fatalf("output = %q, repairs = %v, want the object and trailing_junk", res.Output, res.Report.Repairs)
+	}
+}
+
+func TestFixesEachRepairCanBeDisabled(t *testing.T) {
+	for _, tc := range []struct {
+		repair Repair
+		in     string
+	}{
+		{RepairBOM, "\xEF\xBB\xBF{\"a\":1}"},
+		{RepairLineComments, "{\"a\":1 // c\n}"},
+		{RepairBlockComments, "{\"a\":1 /* c */}"},
+		{RepairTrailingCommas, `[1,]`},
+		{RepairStringNewlines, "{\"a\":\"x\ny\"}"},
+		{RepairStringControls, "{\"a\":\"x\x01y\"}"},
+		{RepairNBSP, "{\"a\":\u00a01}"},
+		{RepairZeroWidth, "{\"a\":\u200b1}"},
+		{RepairASCIIControls, "{\"a\":\x011}"},
+	} {
+		// Each repair runs alone; RepairCRLF keeps Fixes non-zero when it is removed.
+		opt := DefaultOptions()
+		opt.PreserveIfValid = false
+		opt.Fixes = tc.repair | RepairCRLF
+		if _, err := FixBytes([]byte(tc.in), opt); err != nil {
+			t.Fatalf("%v: expected repair to succeed when enabled: %v", tc.repair, err)
+		}
+		opt.Fixes = RepairCRLF
+		_, err := FixBytes([]byte(tc.in), opt)
+		if !errors.Is(err, ErrRepairDisallowed) {
+			t.Fatalf("%v: expected ErrRepairDisallowed, got %v", tc.repair, err)
+		}
+	}
+}
+
+func TestFixesRejectsUnknownRepair(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Fixes = 1 << 31
+	if err := opt.Validate(); !errors.Is(err, ErrOptionsInvalid) {
+		t.Fatalf("expected ErrOptionsInvalid, got %v", err)
+	}
+}
+
+func TestCleanupKeepsExponentSign(t *testing.T) {
+	res, err := FixBytes([]byte(`{"a": 1e+5, "b": 2E+3}`), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]json.Number
+	if err := json.Unmarshal(res.Output, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["a"] != "1e+5" || got["b"] != "2E+3" {
+		t.Fatalf("exponent sign lost: %s", res.Output)
+	}
+	if res.Report.DroppedJunkOutsideStrings != 0 {
+		t.Fatalf("expected no dropped junk, got %d", res.Report.DroppedJunkOutsideStrings)
+	}
+}
+
+func TestCleanupSinglePassRepairs(t *testing.T) {
+	input := []byte("\xEF\xBB\xBFnote {\r\n  \"a\": \"x\ty\", // c\r\n  \"b\": [1, /* c */ 2, /* d */ ],\u00a0junk\r\n  \"c\": \"l1\nl2\",\r\n} tail")
+	var rep Report
+	cl, _ := cleanup(t.Context(), input, DefaultOptions(), &rep, nil, nil)
+	want := "note {\n  \"a\": \"x\\ty\", \n  \"b\": [1,  2  ], \n  \"c\": \"l1\\nl2\"\n} "
+	if string(cl.out) != want {
+		t.Fatalf("unexpected cleanup output:\n%q\nwant\n%q", cl.out, want)
+	}
+	if got := string(cl.out[cl.rootStart:cl.rootEnd]); !strings.HasPrefix(got, "{") || !strings.HasSuffix(got, "}") {
+		t.Fatalf("unexpected root span %q", got)
+	}
+	if rep.RemovedBOM != 1 || rep.NormalizedCRLF != 4 || rep.StrippedLineComments != 1 || rep.StrippedBlockComments != 2 ||
+		rep.RemovedTrailingCommas != 2 || rep.EscapedStringControls != 1 || rep.NormalizedNewlinesInStrings != 1 ||
+		rep.ReplacedNBSP != 1 || rep.DroppedJunkOutsideStrings != 8 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+}
+
+func TestEmitterMatchesMarshalIndent(t *testing.T) {
+	inputs := []string{
+		`{}`, `[]`, `"x"`, `-1.5e+10`, `null`,
+		`{"a":[],"b":{},"c":[{"d":[1,[2,[3]]]}],"e":"<tag> & \"q\" \u00e9 \ud83d\ude00 \u2028"}`,
+		` [ true , false , null , 0 , -0.0 , 1E5 , "\/\b\f\n\r\t" ] `,
+	}
+	for _, input := range inputs {
+		for _, pretty := range []bool{true, false} {
+			opt := DefaultOptions()
+			opt.Pretty = pretty
+			opt.Prefix = ">"
+			opt.Indent = "\t"
+			got, _, err := emitDocument(t.Context(), nil, []byte(input), opt, nil)
+			if err != nil {
+				t.Fatalf("emitDocument(%q): %v", input, err)
+			}
+			v, err := decodeTree([]byte(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []byte
+			if pretty {
+				want, err = json.MarshalIndent(v, opt.Prefix, opt.Indent)
+			} else {
+				want, err = json.Marshal(v)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want)+"\n" {
+				t.Fatalf("emitDocument(%q) pretty=%v:\n%s\nwant\n%s", input, pretty, got, want)
+			}
+		}
+	}
+}
+
+func TestFixBytesKeepsMemberOrder(t *testing.T) {
+	opt := DefaultOptions()
+	opt.PreserveIfValid = false
+	opt.Pretty = false
+	res, err := FixBytes([]byte(`{"format_version":"1.20.0","minecraft:block":{"description":{},"components":{}},}`), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"format_version":"1.20.0","minecraft:block":{"description":{},"components":{}}}` + "\n"
+	if string(res.Output) != want {
+		t.Fatalf("unexpected output %s", res.Output)
+	}
+}
+
+func TestRootValidatorStillReceivesParsedTree(t *testing.T) {
+	opt := DefaultOptions()
+	var got any
+	opt.RootValidator = func(kind RootKind, raw []byte, parsed any) bool {
+		got = parsed
+		return true
+	}
+	if _, err := FixBytes([]byte(`{"a":[1]}`+"\n// x"), opt); err != nil {
+		t.Fatal(err)
+	}
+	m, ok := got.(map[string]any)
+	if !ok || m["a"] == nil {
+		t.Fatalf("expected parsed object, got %#v", got)
+	}
+}
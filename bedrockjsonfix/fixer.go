@@ -0,0 +1,74 @@
+package bedrockjsonfix
+
+import (
+	"context"
+	"sync"
+)
+
+// maxPooledScratchBytes keeps one huge input from pinning its buffers in
+// the pool for the lifetime of a Fixer.
+const maxPooledScratchBytes = 4 << 20
+
+// fixScratch holds the buffers one run of the pipeline can hand to the next.
+type fixScratch struct {
+	trace     offsetTrace
+	clean     []byte
+	stack     []byte
+	emitStack []byte
+	counts    []int
+	emitText  []byte
+	check     []byte
+
+	// jsonc holds the comments kept for OutputJSONC.
+	jsonc jsoncComments
+	// lint, when set, records the repairs for Lint.
+	lint *lintLog
+}
+
+func (sc *fixScratch) size() int {
+	n := cap(sc.clean) + cap(sc.emitText) + cap(sc.counts)*8
+	for _, m := range sc.trace.steps[:cap(sc.trace.steps)] {
+		if m != nil {
+			n += cap(*m) * 16
+		}
+	}
+	return n
+}
+
+// Fixer normalizes inputs with fixed options and reuses scratch buffers
+// between calls. A Fixer is safe for concurrent use.
+type Fixer struct {
+	opt  Options
+	pool sync.Pool
+}
+
+// NewFixer validates opt once and returns a Fixer that applies it.
+func NewFixer(opt Options) (*Fixer, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+	f := &Fixer{opt: opt}
+	f.pool.New = func() any { return new(fixScratch) }
+	return f, nil
+}
+
+// Options returns the options the Fixer applies.
+func (f *Fixer) Options() Options { return f.opt }
+
+// Fix normalizes src like FixBytes and appends the output to dst, returning
+// the extended buffer. Result.Output aliases the appended bytes, so it is
+// only valid until dst is reused. On error dst is returned unchanged.
+func (f *Fixer) Fix(dst, src []byte) ([]byte, Result, error) {
+	return f.FixContext(context.Background(), dst, src)
+}
+
+// FixContext is Fix that stops with ErrContextCanceled once ctx is done, like
+// FixBytesContext.
+func (f *Fixer) FixContext(ctx context.Context, dst, src []byte) ([]byte, Result, error) {
+	sc := f.pool.Get().(*fixScratch)
+	out, res, err := fixBytes(ctx, dst, src, f.opt, sc)
+	if sc.size() <= maxPooledScratchBytes {
+		f.pool.Put(sc)
+	}
+	return out, res, err
+}
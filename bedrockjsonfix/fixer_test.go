@@ -0,0 +1,125 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var fixerInputs = []string{
+	`{"a":1}`,
+	"\xEF\xBB\xBF// pack\r\n{\r\n  \"a\": [1, 2,], /* c */\r\n  \"b\": \"x\ty\",\r\n}\r\n",
+	"note {\"a\": 1 junk} trailing",
+	`{"a":`,
+}
+
+func TestFixerMatchesFixBytes(t *testing.T) {
+	opt := DefaultOptions()
+	f, err := NewFixer(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := []byte("prefix:")
+	for _, input := range fixerInputs {
+		want, wantErr := FixBytes([]byte(input), opt)
+		out, got, err := f.Fix(prefix, []byte(input))
+		if (err == nil) != (wantErr == nil) {
+			t.Fatalf("Fix(%q) error %v, FixBytes error %v", input, err, wantErr)
+		}
+		if err != nil {
+			if err.Error() != wantErr.Error() || !bytes.Equal(out, prefix) {
+				t.Fatalf("Fix(%q) = %q, %v; want prefix and %v", input, out, err, wantErr)
+			}
+			continue
+		}
+		if !bytes.HasPrefix(out, prefix) || !bytes.Equal(out[len(prefix):], want.Output) || !bytes.Equal(got.Output, want.Output) {
+			t.Fatalf("Fix(%q) = %q, want %q", input, out, want.Output)
+		}
+		if got.Report != want.Report || got.Root != want.Root {
+			t.Fatalf("Fix(%q) result %+v, want %+v", input, got, want)
+		}
+	}
+}
+
+func TestNewFixerValidatesOptions(t *testing.T) {
+	opt := DefaultOptions()
+	opt.MaxInputBytes = 0
+	if _, err := NewFixer(opt); !errors.Is(err, ErrOptionsInvalid) {
+		t.Fatalf("expected ErrOptionsInvalid, got %v", err)
+	}
+}
+
+// TestFixerSteadyStateAllocations drives fixBytes with one scratch directly:
+// sync.Pool may drop items at any time, and does so on purpose under -race.
+func TestFixerSteadyStateAllocations(t *testing.T) {
+	input := []byte(`{// line
+"items":[` + strings.Repeat(`{"name":"stone",/* block */"value":1,},`, 64) + `]}`)
+	for _, pretty := range []bool{true, false} {
+		opt := DefaultOptions()
+		opt.Pretty = pretty
+		f, err := NewFixer(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := &fixScratch{}
+		var dst []byte
+		allocs := testing.AllocsPerRun(100, func() {
+			dst, _, err = fixBytes(t.Context(), dst[:0], input, f.Options(), sc)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Fatalf("pretty=%v: expected no steady-state allocations, got %.2f allocs/run", pretty, allocs)
+		}
+	}
+}
+
+func TestValidDocumentMatchesStrictCheck(t *testing.T) {
+	inputs := []string{
+		`{"a":1}`, ` [1, 2.5e-3, "x\u00e9", null] `, `"s"`, `12`, "\r\n{}\r\n",
+		``, ` `, `{"a":1,}`, `[1 2]`, `{"a"}`, `{} {}`, `[01]`, `["\x"]`, "[\"\t\"]",
+		"\xEF\xBB\xBF{}", "{\u00a0}", `// c` + "\n{}", `{"a":tru}`, `[1,]`, `["bad\xff"]`,
+	}
+	sc := &fixScratch{}
+	for _, input := range inputs {
+		wantOK, wantRoot := strictJSONSingleDocument([]byte(input))
+		ok, root, _ := validDocument([]byte(input), Options{}, sc)
+		if ok != wantOK || root != wantRoot {
+			t.Fatalf("validDocument(%q) = %v %v, want %v %v", input, ok, root, wantOK, wantRoot)
+		}
+	}
+}
+
+func TestFixerConcurrentUse(t *testing.T) {
+	f, err := NewFixer(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([][]byte, len(fixerInputs))
+	for i, input := range fixerInputs {
+		if res, err := FixBytes([]byte(input), f.Options()); err == nil {
+			want[i] = res.Output
+		}
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var dst []byte
+			for n := 0; n < 200; n++ {
+				i := n % len(fixerInputs)
+				var err error
+				dst, _, err = f.Fix(dst[:0], []byte(fixerInputs[i]))
+				if (err == nil) != (want[i] != nil) || (err == nil && !bytes.Equal(dst, want[i])) {
+					t.Errorf("Fix(%q) = %q, %v; want %q", fixerInputs[i], dst, err, want[i])
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
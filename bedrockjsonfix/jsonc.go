@@ -0,0 +1,122 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"math"
+)
+
+// keptComment is a comment cleanup set aside for OutputJSONC.
+type keptComment struct {
+	// origin is the offset of the comment in the original input.
+	origin int
+	text   []byte
+	// trailing reports that the comment shares a line with the token
+	// before it, so it is written on that token's line.
+	trailing bool
+}
+
+// jsoncComments places the kept comments while the emitter writes the
+// candidate. A comment is queued when the first token after it in the
+// input is reached and written at the next line break the emitter makes.
+type jsoncComments struct {
+	list []keptComment
+	// trace and base map emitter input offsets to the original input:
+	// the candidate starts at base in the buffer trace ends with.
+	trace *offsetTrace
+	base  int
+
+	next    int // list[:next] are queued or written
+	written int // list[:written] are written
+}
+
+func (n *jsoncComments) reset() {
+	n.next, n.written = 0, 0
+}
+
+// queue queues the comments before the token at off in the emitter input,
+// or all remaining ones when off is math.MaxInt.
+func (n *jsoncComments) queue(off int) {
+	if n.next == len(n.list) {
+		return
+	}
+	o := math.MaxInt
+	if off != math.MaxInt {
+		o = n.trace.origin(n.base + off)
+	}
+	for n.next < len(n.list) && n.list[n.next].origin < o {
+		n.next++
+	}
+}
+
+// writeComments writes the queued comments at depth: trailing ones on the
+// current line and the others on lines of their own. The caller starts a
+// new line afterwards, which also ends a line comment.
+func (e *emitter) writeComments(depth int) {
+	n := e.notes
+	if n == nil {
+		return
+	}
+	afterLine := false
+	for ; n.written < n.next; n.written++ {
+		c := n.list[n.written]
+		if c.trailing && !afterLine {
+			e.out = append(e.out, ' ')
+		} else {
+			e.newline(depth)
+		}
+		e.out = append(e.out, c.text...)
+		afterLine = bytes.HasPrefix(c.text, []byte("//"))
+	}
+}
+
+// writeLeadingComments writes the comments queued before the root value,
+// each on its own line.
+func (e *emitter) writeLeadingComments() {
+	n := e.notes
+	if n == nil {
+		return
+	}
+	for ; n.written < n.next; n.written++ {
+		e.out = append(e.out, n.list[n.written].text...)
+		e.newline(0)
+	}
+}
+
+// hasQueuedComments reports whether comments wait to be written.
+func (e *emitter) hasQueuedComments() bool {
+	return e.notes != nil && e.notes.written < e.notes.next
+}
+
+// track records line breaks and tokens for noteComment.
+func (c *cleaner) track(t lexToken) {
+	switch t.kind {
+	case tokLineComment, tokBlockComment:
+	case tokWhitespace:
+		if bytes.IndexByte(c.in[t.start:t.end], '\n') >= 0 || bytes.IndexByte(c.in[t.start:t.end], '\r') >= 0 {
+			c.sawNewline = true
+		}
+	default:
+		c.sawToken, c.sawNewline = true, false
+	}
+}
+
+// release drops the references to the input held by the comments.
+func (n *jsoncComments) release() {
+	clear(n.list)
+	n.list, n.trace = n.list[:0], nil
+}
+
+// noteComment sets a comment aside for OutputJSONC instead of stripping it
+// silently. A block comment left open at the end of the input is closed,
+// so that the output stays JSONC.
+func (c *cleaner) noteComment(t lexToken) {
+	text := c.in[t.start:t.end:t.end]
+	if t.kind == tokBlockComment && t.flags&flagUnterminated != 0 {
+		text = append(text, " */"...)
+	}
+	*c.notes = append(*c.notes, keptComment{
+		origin:   t.start,
+		text:     text,
+		trailing: c.sawToken && !c.sawNewline,
+	})
+}
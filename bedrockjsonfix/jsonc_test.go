@@ -0,0 +1,107 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOutputJSONCKeepsComments(t *testing.T) {
+	in := "// Resource pack manifest\n{\n  \"format_version\": 2, // v2\n  /* header */\n  \"header\": {\"name\": \"x\",}, // trailing\n  \"modules\": [ // list\n    1, /* one */\n    2\n    // end of list\n  ],\n  \"empty\": { // nothing\n  }\n} // done\n// eof"
+	want := `// Resource pack manifest
+{
+  "format_version": 2, // v2
+  /* header */
+  "header": {
+    "name": "x"
+  }, // trailing
+  "modules": [ // list
+    1, /* one */
+    2
+    // end of list
+  ],
+  "empty": { // nothing
+  }
+} // done
+// eof
+`
+	opt := DefaultOptions()
+	opt.Output = OutputJSONC
+	res, err := FixString(in, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Output) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", res.Output, want)
+	}
+	rep := res.Report
+	if rep.KeptComments != 10 || rep.StrippedLineComments != 0 || rep.StrippedBlockComments != 0 || rep.Repairs&RepairLineComments != 0 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	if rep.RemovedTrailingCommas != 1 {
+		t.Fatalf("expected other repairs to apply, got %+v", rep)
+	}
+
+	f, err := NewFixer(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		_, got, err := f.Fix(nil, []byte(in))
+		if err != nil || string(got.Output) != want {
+			t.Fatalf("Fixer output differs: %v\n%s", err, got.Output)
+		}
+	}
+}
+
+func TestOutputJSONCAfterRootTrimAndScan(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Output = OutputJSONC
+	res, err := FixString("log line {\"a\": 1 /* one */} trailing text", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"a\": 1 /* one */\n}\n"; string(res.Output) != want || res.Report.KeptComments != 1 {
+		t.Fatalf("got %q with %d comments", res.Output, res.Report.KeptComments)
+	}
+
+	opt.TrimToFirstRoot = false
+	opt.RootPolicy = RootPolicyScanBestEffort
+	opt.RootScanMaxCandidates = 5
+	res, err = FixString("{{oops} /* skipped */ {\"ok\": true, // yes\n}", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/* skipped */\n{\n  \"ok\": true // yes\n}\n"; string(res.Output) != want || !res.Report.RootScanUsed {
+		t.Fatalf("got %q", res.Output)
+	}
+}
+
+func TestOutputJSONCClosesOpenBlockComment(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Output = OutputJSONC
+	res, err := FixString(`{"a":1} /* open`, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"a\": 1\n} /* open */\n"; string(res.Output) != want || res.Report.KeptComments != 1 {
+		t.Fatalf("got %q with %d comments", res.Output, res.Report.KeptComments)
+	}
+}
+
+func TestOutputJSONCOptions(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Output = OutputJSONC
+	opt.Pretty = false
+	if err := opt.Validate(); !errors.Is(err, ErrOptionsInvalid) {
+		t.Fatalf("expected compact JSONC to be rejected, got %v", err)
+	}
+	opt.Pretty, opt.BuildSourceMap = true, true
+	if err := opt.Validate(); !errors.Is(err, ErrOptionsInvalid) {
+		t.Fatalf("expected JSONC with source maps to be rejected, got %v", err)
+	}
+	sopt := DefaultStreamOptions()
+	sopt.Output = OutputJSONC
+	if _, _, err := streamString(t, `{}`, sopt); !errors.Is(err, ErrStreamUnsupported) {
+		t.Fatalf("expected ErrStreamUnsupported, got %v", err)
+	}
+}
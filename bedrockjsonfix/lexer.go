@@ -0,0 +1,273 @@
+package bedrockjsonfix
+
+import "unicode/utf8"
+
+// tokenKind classifies a span of tolerant JSON-ish input.
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	// tokWhitespace is a run of JSON whitespace plus the invisible characters
+	// the pipeline can repair: CR, ASCII controls, NBSP and zero-width runes.
+	tokWhitespace
+	tokLineComment
+	tokBlockComment
+	tokString
+	tokNumber
+	tokLiteral
+	tokPunct
+	// tokJunk is a run of bytes that cannot start any other token.
+	tokJunk
+)
+
+// tokenFlags record which repairable characters a token contains, so clean
+// tokens can be copied without a second look.
+type tokenFlags uint8
+
+const (
+	flagCR tokenFlags = 1 << iota
+	flagControl
+	flagNewline
+	flagNBSP
+	flagZeroWidth
+	flagUnterminated
+)
+
+type lexToken struct {
+	kind  tokenKind
+	flags tokenFlags
+	start int
+	end   int
+}
+
+// tolerantLexer splits input into tokens with one string/escape state
+// machine. It never fails: anything unrecognized becomes tokJunk.
+type tolerantLexer struct {
+	in       []byte
+	pos      int
+	comments bool
+}
+
+func newTolerantLexer(in []byte, from int, comments bool) tolerantLexer {
+	return tolerantLexer{in: in, pos: from, comments: comments}
+}
+
+func (lx *tolerantLexer) next() lexToken {
+	in := lx.in
+	start := lx.pos
+	if start >= len(in) {
+		return lexToken{kind: tokEOF, start: start, end: start}
+	}
+	c := in[start]
+	switch {
+	case c == '"':
+		return lx.string(start)
+	case c == '{' || c == '}' || c == '[' || c == ']' || c == ':' || c == ',':
+		lx.pos++
+		return lexToken{kind: tokPunct, start: start, end: lx.pos}
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		lx.pos = numberEnd(in, start)
+		return lexToken{kind: tokNumber, start: start, end: lx.pos}
+	case lx.comments && c == '/' && start+1 < len(in) && in[start+1] == '/':
+		i := start + 2
+		for i < len(in) && in[i] != '\n' && in[i] != '\r' {
+			i++
+		}
+		lx.pos = i
+		return lexToken{kind: tokLineComment, start: start, end: i}
+	case lx.comments && c == '/' && start+1 < len(in) && in[start+1] == '*':
+		i := start + 2
+		for i+1 < len(in) && (in[i] != '*' || in[i+1] != '/') {
+			i++
+		}
+		t := lexToken{kind: tokBlockComment, start: start}
+		if i+1 < len(in) {
+			i += 2
+		} else {
+			i = len(in)
+			t.flags = flagUnterminated
+		}
+		lx.pos = i
+		t.end = i
+		return t
+	}
+	if _, ok := whitespaceFlag(in, start); ok {
+		return lx.whitespace(start)
+	}
+	if isAlpha(c) {
+		if n := literalLen(in, start); n > 0 {
+			lx.pos = start + n
+			return lexToken{kind: tokLiteral, start: start, end: lx.pos}
+		}
+	}
+	return lx.junk(start)
+}
+
+func (lx *tolerantLexer) whitespace(start int) lexToken {
+	t := lexToken{kind: tokWhitespace, start: start}
+	i := start
+	for i < len(lx.in) {
+		f, ok := whitespaceFlag(lx.in, i)
+		if !ok {
+			break
+		}
+		t.flags |= f
+		i += whitespaceWidth(lx.in[i])
+	}
+	lx.pos = i
+	t.end = i
+	return t
+}
+
+// whitespaceFlag reports whether a whitespace-like character starts at i and
+// which repair flag it needs.
+func whitespaceFlag(in []byte, i int) (tokenFlags, bool) {
+	c := in[i]
+	switch {
+	case c == ' ' || c == '\t' || c == '\n':
+		return 0, true
+	case c == '\r':
+		return flagCR, true
+	case c < 0x20:
+		return flagControl, true
+	case c == 0xC2:
+		if i+1 < len(in) && in[i+1] == 0xA0 {
+			return flagNBSP, true
+		}
+	case c == 0xE2:
+		if isZeroWidthAt(in, i) {
+			return flagZeroWidth, true
+		}
+	}
+	return 0, false
+}
+
+func whitespaceWidth(c byte) int {
+	switch c {
+	case 0xC2:
+		return 2
+	case 0xE2:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// isZeroWidthAt matches U+200B, U+200C, U+200D and U+2060.
+func isZeroWidthAt(in []byte, i int) bool {
+	if i+2 >= len(in) || in[i] != 0xE2 {
+		return false
+	}
+	switch {
+	case in[i+1] == 0x80:
+		return in[i+2] >= 0x8B && in[i+2] <= 0x8D
+	case in[i+1] == 0x81:
+		return in[i+2] == 0xA0
+	}
+	return false
+}
+
+func (lx *tolerantLexer) string(start int) lexToken {
+	in := lx.in
+	t := lexToken{kind: tokString, start: start}
+	esc := false
+	i := start + 1
+	for ; i < len(in); i++ {
+		c := in[i]
+		if esc {
+			esc = false
+			continue
+		}
+		switch {
+		case c == '\\':
+			esc = true
+		case c == '"':
+			lx.pos = i + 1
+			t.end = lx.pos
+			return t
+		case c == '\n':
+			t.flags |= flagNewline
+		case c < 0x20:
+			t.flags |= flagControl
+		case c == 0xC2 && i+1 < len(in) && in[i+1] == 0xA0:
+			t.flags |= flagNBSP
+		case c == 0xE2 && isZeroWidthAt(in, i):
+			t.flags |= flagZeroWidth
+		}
+	}
+	t.flags |= flagUnterminated
+	lx.pos = len(in)
+	t.end = lx.pos
+	return t
+}
+
+// junk consumes bytes up to the next byte that can start another token.
+// Alphabetic runs are consumed whole unless they are a literal.
+func (lx *tolerantLexer) junk(start int) lexToken {
+	in := lx.in
+	i := start
+	for i < len(in) {
+		c := in[i]
+		if isAlpha(c) {
+			if literalLen(in, i) > 0 {
+				break
+			}
+			for i < len(in) && isAlpha(in[i]) {
+				i++
+			}
+			continue
+		}
+		if i > start && lx.startsToken(i) {
+			break
+		}
+		if c < utf8.RuneSelf {
+			i++
+			continue
+		}
+		_, sz := utf8.DecodeRune(in[i:])
+		i += sz
+	}
+	lx.pos = i
+	return lexToken{kind: tokJunk, start: start, end: i}
+}
+
+func (lx *tolerantLexer) startsToken(i int) bool {
+	c := lx.in[i]
+	switch {
+	case c == '"', c == '{', c == '}', c == '[', c == ']', c == ':', c == ',':
+		return true
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return true
+	case c == '/' && lx.comments && i+1 < len(lx.in) && (lx.in[i+1] == '/' || lx.in[i+1] == '*'):
+		return true
+	}
+	_, ok := whitespaceFlag(lx.in, i)
+	return ok
+}
+
+// numberEnd returns the end of a number-like lexeme. '+' is only part of the
+// lexeme directly after an exponent marker.
+func numberEnd(in []byte, start int) int {
+	i := start
+	for i < len(in) {
+		c := in[i]
+		switch {
+		case (c >= '0' && c <= '9') || c == '-' || c == '.' || c == 'e' || c == 'E':
+		case c == '+' && i > start && (in[i-1] == 'e' || in[i-1] == 'E'):
+		default:
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+// literalLen returns the length of a true/false/null literal at start, or 0.
+func literalLen(in []byte, start int) int {
+	for _, lit := range [...]string{"true", "false", "null"} {
+		if hasLiteralToken(in, start, lit) {
+			return len(lit)
+		}
+	}
+	return 0
+}
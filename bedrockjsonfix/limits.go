@@ -0,0 +1,61 @@
+package bedrockjsonfix
+
+import "fmt"
+
+// defaultMaxDepth matches the nesting limit of encoding/json, which bounded
+// every document before output was emitted token by token.
+const defaultMaxDepth = 10000
+
+// emitLimits are the structural limits of Options. Zero means unlimited.
+type emitLimits struct {
+	depth       int
+	stringBytes int
+	members     int
+	elements    int
+	tokens      int
+}
+
+func limitsFromOptions(opt Options) emitLimits {
+	return emitLimits{
+		depth:       opt.MaxDepth,
+		stringBytes: opt.MaxStringBytes,
+		members:     opt.MaxObjectMembers,
+		elements:    opt.MaxArrayElements,
+		tokens:      opt.MaxTokens,
+	}
+}
+
+// exceeded returns the emitter error for the limit named after its Options
+// field, describing what was counted.
+func exceeded(limit, what string, max int) *emitError {
+	return &emitError{reason: fmt.Sprintf("%s exceeds %s (%d)", what, limit, max), limit: limit}
+}
+
+// asLimitError returns err as an emitter error when it is a limit
+// violation. Emitter errors are never wrapped.
+func asLimitError(err error) (*emitError, bool) {
+	if ee, ok := err.(*emitError); ok && ee.limit != "" {
+		return ee, true
+	}
+	return nil, false
+}
+
+// limitErrorAt builds the limit_exceeded error for a violation located at
+// inputOffset in the original input.
+func limitErrorAt(input []byte, inputOffset int, ee *emitError) *FixError {
+	pos := positionAt(input, inputOffset)
+	return newLimitError(pos, snippetAt(input, pos), ee)
+}
+
+func newLimitError(pos Position, snippet string, ee *emitError) *FixError {
+	return &FixError{
+		Code:     "limit_exceeded",
+		Message:  fmt.Sprintf("line %d, column %d: %s", pos.Line, pos.Column, ee.reason),
+		Cause:    ErrLimitExceeded,
+		Position: pos,
+		Snippet:  snippet,
+		Reason:   ee.reason,
+		Stage:    StageParse,
+		Limit:    ee.limit,
+	}
+}
@@ -0,0 +1,81 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStructuralLimits(t *testing.T) {
+	cases := []struct {
+		limit string
+		set   func(*Options)
+		ok    string
+		bad   string
+		col   int
+	}{
+		{"MaxDepth", func(o *Options) { o.MaxDepth = 2 }, `{"a":[1]}`, `{"a":[[1]]}`, 7},
+		{"MaxStringBytes", func(o *Options) { o.MaxStringBytes = 3 }, `{"abc":"xyz"}`, `{"abc":"wxyz"}`, 8},
+		{"MaxObjectMembers", func(o *Options) { o.MaxObjectMembers = 2 }, `{"a":{"b":1,"c":2},"d":3}`, `{"a":1,"b":2,"c":3}`, 14},
+		{"MaxArrayElements", func(o *Options) { o.MaxArrayElements = 2 }, `[[1,2],[3,4]]`, `[1,2,3]`, 6},
+		{"MaxTokens", func(o *Options) { o.MaxTokens = 5 }, `{"a":1}`, `{"a":[]}`, 8},
+	}
+	for _, tc := range cases {
+		for _, preserve := range []bool{true, false} {
+			for _, mode := range []Mode{ModeBedrock, ModeStrict} {
+				opt := DefaultOptions()
+				opt.PreserveIfValid = preserve
+				opt.Mode = mode
+				tc.set(&opt)
+				if _, err := FixString(tc.ok, opt); err != nil {
+					t.Fatalf("%s: %s at the limit: %v", tc.limit, tc.ok, err)
+				}
+				_, err := FixString(tc.bad, opt)
+				var fe *FixError
+				if !errors.As(err, &fe) || !errors.Is(err, ErrLimitExceeded) || errors.Is(err, ErrInvalidJSON) {
+					t.Fatalf("%s preserve=%v mode=%v: expected ErrLimitExceeded, got %v", tc.limit, preserve, mode, err)
+				}
+				if fe.Code != "limit_exceeded" || fe.Limit != tc.limit || fe.Line != 1 || fe.Column != tc.col || !strings.Contains(fe.Message, tc.limit) {
+					t.Fatalf("%s preserve=%v mode=%v: unexpected error %+v", tc.limit, preserve, mode, fe)
+				}
+			}
+		}
+	}
+}
+
+func TestStructuralLimitPositionAfterRepairs(t *testing.T) {
+	opt := DefaultOptions()
+	opt.MaxArrayElements = 2
+	_, err := FixString("// header\n[1, /* two */ 2,\n 3]", opt)
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Limit != "MaxArrayElements" || fe.Line != 3 || fe.Column != 2 {
+		t.Fatalf("expected MaxArrayElements at 3:2, got %v", err)
+	}
+}
+
+func TestDefaultMaxDepthStopsDeepNesting(t *testing.T) {
+	input := strings.Repeat("[", 1<<20)
+	_, err := FixString(input, DefaultOptions())
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Limit != "MaxDepth" || fe.Offset != defaultMaxDepth {
+		t.Fatalf("expected MaxDepth at offset %d, got %v", defaultMaxDepth, err)
+	}
+}
+
+func TestFixStreamStructuralLimits(t *testing.T) {
+	opt := DefaultStreamOptions()
+	opt.MaxObjectMembers = 1
+	_, _, err := streamString(t, "{\n  \"a\": 1,\n  \"b\": 2\n}", opt)
+	var fe *FixError
+	if !errors.As(err, &fe) || !errors.Is(err, ErrLimitExceeded) || fe.Limit != "MaxObjectMembers" || fe.Line != 3 || fe.Column != 3 {
+		t.Fatalf("expected MaxObjectMembers at 3:3, got %v", err)
+	}
+}
+
+func TestStructuralLimitsRejectNegative(t *testing.T) {
+	opt := DefaultOptions()
+	opt.MaxTokens = -1
+	if err := opt.Validate(); !errors.Is(err, ErrOptionsInvalid) {
+		t.Fatalf("expected ErrOptionsInvalid, got %v", err)
+	}
+}
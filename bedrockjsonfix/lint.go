@@ -0,0 +1,321 @@
+package bedrockjsonfix
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Stable diagnostic codes reported by Lint. Failures that FixBytes cannot
+// repair use the matching FixError code ("invalid_json", "no_root", ...).
+const (
+	DiagBOM           = "bom"
+	DiagInvalidUTF8   = "invalid_utf8"
+	DiagLineComment   = "line_comment"
+	DiagBlockComment  = "block_comment"
+	DiagTrailingComma = "trailing_comma"
+	DiagNBSP          = "nbsp"
+	DiagZeroWidth     = "zero_width"
+	DiagControlChar   = "control_char"
+	DiagStringControl = "string_control_char"
+	DiagStringNewline = "string_newline"
+	DiagJunk          = "junk"
+	DiagLeadingData   = "leading_data"
+	DiagTrailingData  = "trailing_data"
+	DiagMultipleRoots = "multiple_roots"
+)
+
+// Diagnostic is one problem found by Lint.
+type Diagnostic struct {
+	Code     string
+	Severity Severity
+	Message  string
+	// Position is where the problem starts in the input.
+	Position
+	// Length is the number of input bytes covered, when known.
+	Length int
+	// Repair is the repair that fixes the problem, or zero if none can.
+	Repair Repair
+}
+
+// Diagnostics is the result of Lint.
+type Diagnostics struct {
+	// Items are ordered by input offset.
+	Items []Diagnostic
+	// NeedsFix reports that the input is not strict JSON as-is.
+	NeedsFix bool
+	// Root is the detected root kind.
+	Root RootKind
+}
+
+// lintWarnings are the warning codes Lint reports as positioned
+// diagnostics. Other warnings of the run are added without a position.
+var lintWarnings = map[string]bool{
+	WarnCP1252Fallback:        true,
+	WarnJunkDropped:           true,
+	WarnLeadingDataDiscarded:  true,
+	WarnTrailingDataDiscarded: true,
+	WarnNBSPReplacedInStrings: true,
+}
+
+// Lint reports what FixBytes would repair without returning output.
+//
+// Lint runs the FixBytes pipeline with the same options and records each
+// repair where it is applied, so PreserveIfValid, the limits and root
+// scanning are judged exactly as FixBytes would judge them. The document is
+// validated but not written, so Lint costs less than FixBytes. Positions
+// refer to the input after DecodeTransport. The returned error is the one
+// FixBytes would return, and it is also the last diagnostic.
+func Lint(input []byte, opt Options) (Diagnostics, error) {
+	if err := opt.Validate(); err != nil {
+		return Diagnostics{}, err
+	}
+	opt.Pretty = false
+	opt.BuildSourceMap = false
+	ls := lintPool.Get().(*lintScratch)
+	log := lintLog{fixes: opt.effectiveFixes(), input: input, items: ls.items[:0]}
+	ls.sc.lint = &log
+	_, res, err := fixBytes(context.Background(), nil, input, opt, &ls.sc)
+	var extra []Diagnostic
+	for _, w := range res.Warnings {
+		if !lintWarnings[w.Code] {
+			extra = append(extra, Diagnostic{Code: w.Code, Severity: w.Severity, Message: w.Message})
+		}
+	}
+	items := log.diagnostics(extra)
+	ls.sc.lint, ls.items = nil, log.items[:0]
+	if ls.sc.size()+cap(ls.items)*24 <= maxPooledScratchBytes {
+		lintPool.Put(ls)
+	}
+	d := Diagnostics{Items: items, Root: res.Root, NeedsFix: err != nil || res.Report.Repairs != 0 || len(items) > 0}
+	if !d.NeedsFix {
+		ok, _ := strictJSONSingleDocument(input)
+		d.NeedsFix = !ok
+	}
+	if err != nil {
+		var fe *FixError
+		if errors.As(err, &fe) {
+			d.Items = append(d.Items, Diagnostic{Code: fe.Code, Severity: SeverityError, Message: fe.Message, Position: fe.Position})
+		}
+		return d, err
+	}
+	return d, nil
+}
+
+// lintScratch is the scratch space of a Lint call, reused like a Fixer's.
+type lintScratch struct {
+	sc    fixScratch
+	items []lintItem
+}
+
+var lintPool = sync.Pool{New: func() any { return new(lintScratch) }}
+
+// lintKind is a problem the pipeline records for Lint.
+type lintKind uint8
+
+const (
+	lintBOM lintKind = iota
+	lintInvalidUTF8
+	lintLineComment
+	lintBlockComment
+	lintTrailingComma
+	lintControlChar
+	lintNBSP
+	lintZeroWidth
+	lintStringNewline
+	lintStringControl
+	lintStringNBSP
+	lintStringZeroWidth
+	lintJunk
+	lintLeadingData
+	lintTrailingData
+	lintMultipleRoots
+)
+
+// lintKinds describes each lintKind. Junk messages are built from the
+// length of the run.
+var lintKinds = [...]struct {
+	code     string
+	repair   Repair
+	severity Severity
+	message  string
+}{
+	lintBOM:             {DiagBOM, RepairBOM, SeverityInfo, "UTF-8 byte order mark"},
+	lintInvalidUTF8:     {DiagInvalidUTF8, RepairCP1252, SeverityWarning, "input is not valid UTF-8; it will be decoded as Windows-1252"},
+	lintLineComment:     {DiagLineComment, RepairLineComments, SeverityInfo, "line comment"},
+	lintBlockComment:    {DiagBlockComment, RepairBlockComments, SeverityInfo, "block comment"},
+	lintTrailingComma:   {DiagTrailingComma, RepairTrailingCommas, SeverityInfo, "trailing comma"},
+	lintControlChar:     {DiagControlChar, RepairASCIIControls, SeverityInfo, "control character outside strings"},
+	lintNBSP:            {DiagNBSP, RepairNBSP, SeverityInfo, "non-breaking space outside strings"},
+	lintZeroWidth:       {DiagZeroWidth, RepairZeroWidth, SeverityInfo, "zero-width character outside strings"},
+	lintStringNewline:   {DiagStringNewline, RepairStringNewlines, SeverityInfo, "literal newline inside string"},
+	lintStringControl:   {DiagStringControl, RepairStringControls, SeverityInfo, "unescaped control character inside string"},
+	lintStringNBSP:      {DiagNBSP, RepairStringWhitespace, SeverityWarning, "non-breaking space inside string"},
+	lintStringZeroWidth: {DiagZeroWidth, RepairStringWhitespace, SeverityWarning, "zero-width character inside string"},
+	lintJunk:            {DiagJunk, RepairDropJunk, SeverityWarning, ""},
+	lintLeadingData:     {DiagLeadingData, RepairLeadingJunk, SeverityWarning, "data before the root value"},
+	lintTrailingData:    {DiagTrailingData, RepairTrailingJunk, SeverityWarning, "data after the root value"},
+	lintMultipleRoots:   {DiagMultipleRoots, RepairTrailingJunk, SeverityWarning, "another root value after the first one"},
+}
+
+// lintItem is a recorded problem at in[start:end].
+type lintItem struct {
+	kind       lintKind
+	start, end int
+}
+
+// lintLog collects the repairs fixBytes applies, for Lint. Offsets are into
+// the buffer of the pass that records them; fixBytes maps items[mapped:] to
+// the input once the pass is done. Items are kept small while the pipeline
+// runs and become Diagnostics once it is done.
+type lintLog struct {
+	fixes Repair
+	// input is the buffer positions refer to: the input of fixBytes after
+	// DecodeTransport.
+	input  []byte
+	items  []lintItem
+	mapped int
+}
+
+// add records a problem of in[start:end]. It is a no-op on a nil log, so
+// passes call it unconditionally.
+func (l *lintLog) add(kind lintKind, start, end int) {
+	if l == nil {
+		return
+	}
+	if n := len(l.items); kind == lintJunk && n > l.mapped && l.items[n-1].kind == lintJunk && l.items[n-1].end == start {
+		// Adjacent junk runs are one diagnostic.
+		l.items[n-1].end = end
+		return
+	}
+	l.items = append(l.items, lintItem{kind: kind, start: start, end: end})
+}
+
+// trimmed records the data other than whitespace in b[from:to] of the
+// current buffer of trace as data before or after the root.
+func (l *lintLog) trimmed(b []byte, from, to int, leading bool, trace *offsetTrace) {
+	if l == nil {
+		return
+	}
+	for from < to && isSpace(b[from]) {
+		from++
+	}
+	if from == to {
+		return
+	}
+	n := len(l.items)
+	switch {
+	case leading:
+		l.add(lintLeadingData, from, to)
+	case b[from] == '{' || b[from] == '[':
+		l.add(lintMultipleRoots, from, to)
+	default:
+		l.add(lintTrailingData, from, to)
+	}
+	l.mapTo(n, trace, trace.len())
+}
+
+// mapTo maps the items from index n on through the first passes of trace,
+// and marks every item as mapped.
+func (l *lintLog) mapTo(n int, trace *offsetTrace, passes int) {
+	for i := range l.items[n:] {
+		it := &l.items[n+i]
+		it.start = trace.originBefore(passes, it.start)
+		it.end = trace.originBefore(passes, it.end)
+	}
+	l.mapped = len(l.items)
+}
+
+// truncate drops the items recorded after the first n, for a root scan
+// that retries.
+func (l *lintLog) truncate(n int) {
+	if l != nil {
+		l.items = l.items[:n]
+		l.mapped = n
+	}
+}
+
+func (l *lintLog) len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.items)
+}
+
+// diagnostics converts the items and appends extra, sorted by offset with
+// line and column filled in by one pass over the input. Repairs missing
+// from fixes are raised to SeverityError.
+func (l *lintLog) diagnostics(extra []Diagnostic) []Diagnostic {
+	ds := make([]Diagnostic, len(l.items), len(l.items)+len(extra))
+	for i, it := range l.items {
+		k := &lintKinds[it.kind]
+		d := &ds[i]
+		d.Code, d.Severity, d.Message, d.Repair = k.code, k.severity, k.message, k.repair
+		d.Offset, d.Length = it.start, it.end-it.start
+		if it.kind == lintJunk {
+			d.Message = fmt.Sprintf("%d junk bytes outside strings", d.Length)
+		}
+		if l.fixes&k.repair == 0 {
+			d.Severity = SeverityError
+			d.Message += " (" + k.repair.String() + " repair is disabled)"
+		}
+	}
+	ds = append(ds, extra...)
+	byOffset := func(a, b Diagnostic) int { return cmp.Compare(a.Offset, b.Offset) }
+	if !slices.IsSortedFunc(ds, byOffset) {
+		slices.SortStableFunc(ds, byOffset)
+	}
+	p := Position{Line: 1, Column: 1}
+	for i := range ds {
+		off := minInt(ds[i].Offset, len(l.input))
+		p = advancePosition(p, l.input[p.Offset:off])
+		ds[i].Position = p
+	}
+	return ds
+}
+
+// disallowedRepairError explains a parse failure that repairs disabled in the
+// effective fixes would have avoided, or returns nil. It runs the pipeline
+// again with every repair enabled and, when that run succeeds, names the
+// first disabled repair it applied.
+func disallowedRepairError(ctx context.Context, input []byte, opt Options) *FixError {
+	fixes := opt.effectiveFixes()
+	probe := opt
+	probe.Fixes = RepairsBedrock
+	probe.AllowCP1252Fallback = true
+	probe.AggressiveWhitespace = true
+	probe.DropJunkOutsideStrings = true
+	probe.TrimToFirstRoot = true
+	probe.TrimAfterFirstRoot = true
+	probe.EscapeStringControls = true
+	probe.MaxRisk = RiskNone
+	probe.MaxDroppedJunkBytes = 0
+	probe.Output = OutputJSON
+	probe.Pretty = false
+	probe.BuildSourceMap = false
+	if fixes == 0 || probe.effectiveFixes() == fixes {
+		return nil
+	}
+	log := lintLog{fixes: fixes, input: input}
+	if _, _, err := fixBytes(ctx, nil, input, probe, &fixScratch{lint: &log}); err != nil {
+		return nil
+	}
+	for _, d := range log.diagnostics(nil) {
+		if d.Severity != SeverityError || d.Repair == 0 {
+			continue
+		}
+		return &FixError{
+			Code:     "repair_disallowed",
+			Message:  fmt.Sprintf("line %d, column %d: %s repair is disabled", d.Line, d.Column, d.Repair),
+			Cause:    errors.Join(ErrRepairDisallowed, ErrInvalidJSON),
+			Position: d.Position,
+			Snippet:  snippetAt(log.input, d.Position),
+			Reason:   d.Message,
+			Stage:    StageParse,
+		}
+	}
+	return nil
+}
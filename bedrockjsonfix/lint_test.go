@@ -0,0 +1,169 @@
+package bedrockjsonfix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func lintCodes(d Diagnostics) map[string]Diagnostic {
+	m := make(map[string]Diagnostic)
+	for _, it := range d.Items {
+		if _, ok := m[it.Code]; !ok {
+			m[it.Code] = it
+		}
+	}
+	return m
+}
+
+func TestLintValidJSONNeedsNoFix(t *testing.T) {
+	d, err := Lint([]byte(`{"a":[1,2,{"b":null}]}`), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.NeedsFix || len(d.Items) != 0 || d.Root != RootObject {
+		t.Fatalf("unexpected diagnostics: %+v", d)
+	}
+}
+
+func TestLintReportsFixableProblems(t *testing.T) {
+	in := []byte("\xEF\xBB\xBFhello {\n  // c\n  \"a\": 1, /* b */\n  \"b\": [1, 2,],\n  \"c\": \"x\ty\" $$\n} {\"z\":1}")
+	d, err := Lint(in, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.NeedsFix || d.Root != RootObject {
+		t.Fatalf("expected NeedsFix with object root, got %+v", d)
+	}
+	got := lintCodes(d)
+	for code, want := range map[string]struct {
+		line, col int
+		sev       Severity
+	}{
+		DiagBOM:           {1, 1, SeverityInfo},
+		DiagLeadingData:   {1, 2, SeverityWarning},
+		DiagLineComment:   {2, 3, SeverityInfo},
+		DiagBlockComment:  {3, 11, SeverityInfo},
+		DiagTrailingComma: {4, 13, SeverityInfo},
+		DiagStringControl: {5, 10, SeverityInfo},
+		DiagJunk:          {5, 14, SeverityWarning},
+		DiagMultipleRoots: {6, 3, SeverityWarning},
+	} {
+		it, ok := got[code]
+		if !ok {
+			t.Fatalf("missing %q diagnostic in %+v", code, d.Items)
+		}
+		if it.Line != want.line || it.Column != want.col || it.Severity != want.sev {
+			t.Fatalf("%q: got line %d column %d severity %v, want %+v", code, it.Line, it.Column, it.Severity, want)
+		}
+	}
+	if _, err := FixBytes(in, DefaultOptions()); err != nil {
+		t.Fatalf("lint claimed input is fixable but FixBytes failed: %v", err)
+	}
+}
+
+func TestLintUnfixableReturnsFixBytesError(t *testing.T) {
+	d, err := Lint([]byte("{\n\"a\": 1\n\"b\": 2}"), DefaultOptions())
+	if !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("expected ErrInvalidJSON, got %v", err)
+	}
+	last := d.Items[len(d.Items)-1]
+	if last.Code != "invalid_json" || last.Severity != SeverityError || last.Line != 3 {
+		t.Fatalf("unexpected error diagnostic: %+v", last)
+	}
+}
+
+func TestLintDisabledRepairIsError(t *testing.T) {
+	opt := DefaultOptions()
+	opt.TrimAfterFirstRoot = false
+	opt.RootPolicy = RootPolicyFirst
+	_, err := Lint([]byte(`{"a":1} {"b":2}`), opt)
+	if !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("expected ErrInvalidJSON, got %v", err)
+	}
+}
+
+func TestLintConfirmsRootScanRecovery(t *testing.T) {
+	opt := DefaultOptions()
+	opt.TrimToFirstRoot = false
+	opt.RootPolicy = RootPolicyScanBestEffort
+	d, err := Lint([]byte(`{{oops} {"ok":true}`), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lintCodes(d)[WarnRootScanUsed]; !ok {
+		t.Fatalf("expected root scan diagnostic, got %+v", d.Items)
+	}
+}
+
+func TestLintAgreesWithFixBytes(t *testing.T) {
+	strict := DefaultOptions()
+	strict.PreserveIfValid = false
+	limited := DefaultOptions()
+	limited.MaxDepth = 1
+	scan := DefaultOptions()
+	scan.TrimToFirstRoot = false
+	scan.RootPolicy = RootPolicyScanBestEffort
+	noCommas := DefaultOptions()
+	noCommas.Fixes &^= RepairTrailingCommas
+	inputs := append([]string{`"null"`, "null", `{"a":[1]}`, "x {\"a\":\"\u200b\u00a0\"}\x01", "\uFEFFconst x = {\"a\":1};"}, streamCorpus...)
+	// Positionless diagnostics carry no repair.
+	const unplaced = RepairCRLF | RepairRootScan | RepairCodeWrapper
+	for _, opt := range []Options{DefaultOptions(), strict, limited, scan, noCommas} {
+		for _, input := range inputs {
+			res, fixErr := FixBytes([]byte(input), opt)
+			d, err := Lint([]byte(input), opt)
+			if fmt.Sprint(err) != fmt.Sprint(fixErr) {
+				t.Fatalf("Lint(%q) error = %v, FixBytes error = %v", input, err, fixErr)
+			}
+			if err != nil {
+				if last := d.Items[len(d.Items)-1]; last.Severity != SeverityError || !d.NeedsFix {
+					t.Fatalf("Lint(%q) = %+v, want an error diagnostic last", input, d)
+				}
+				continue
+			}
+			var repairs Repair
+			for _, it := range d.Items {
+				repairs |= it.Repair
+			}
+			if d.Root != res.Root || repairs != res.Report.Repairs&^unplaced {
+				t.Fatalf("Lint(%q) root %v repairs %v, FixBytes root %v repairs %v", input, d.Root, repairs, res.Root, res.Report.Repairs)
+			}
+		}
+	}
+}
+
+func TestLintPreserveIfValid(t *testing.T) {
+	opt := DefaultOptions()
+	opt.PreserveIfValid = false
+	if _, err := Lint([]byte(`"null"`), opt); !errors.Is(err, ErrNoRootFound) {
+		t.Fatalf("expected ErrNoRootFound, got %v", err)
+	}
+	opt.MaxDepth = 1
+	if _, err := Lint([]byte(`{"a":[1]}`), opt); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+func TestCheckDocumentAgreesWithEmitter(t *testing.T) {
+	inputs := []string{
+		`{"a":[1,-2.5e+3,true,false,null,{}],"b":"x\"\\éy","c":[]}`,
+		" [ 0 , \"\" ]\r\n", `"s"`, `1`, `{"a":1,}`, `[1 2]`, `{"a" 1}`, `{"a":1]`, `[01]`, `[tru]`,
+		`[1]/* c */`, `[1] [2]`, `["a` + "\x01" + `"]`, `["\q"]`, `["\u12"]`, `{"a":`, `[1,`, `"open`,
+		"[ ]", `[1}`, `[[[[1]]]]`, `{"ab":{"cd":[1,2,3]}}`, `{1:2}`, `[,]`, `[1,]`,
+	}
+	limited := []Options{DefaultOptions(), {MaxDepth: 2}, {MaxTokens: 8}, {MaxStringBytes: 1}, {MaxObjectMembers: 1}, {MaxArrayElements: 2}}
+	for _, opt := range limited {
+		for _, input := range inputs {
+			_, wantKind, wantErr := emitDocument(context.Background(), nil, []byte(input), opt, nil)
+			kind, err := checkDocument(context.Background(), []byte(input), opt, new(fixScratch))
+			if kind != wantKind || fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Fatalf("checkDocument(%q, %+v) = %v, %v; emitDocument = %v, %v", input, limitsFromOptions(opt), kind, err, wantKind, wantErr)
+			}
+		}
+	}
+	if _, ok := scanStrict(context.Background(), []byte(inputs[0]), emitLimits{}, new(fixScratch)); !ok {
+		t.Fatalf("scanStrict refused %q", inputs[0])
+	}
+}
@@ -0,0 +1,262 @@
+package bedrockjsonfix
+
+import "bytes"
+
+// mdFence is a fenced code block found by unwrapMarkdown. segs are the
+// input spans of its content lines, without blockquote prefixes.
+type mdFence struct {
+	json bool // tagged json, jsonc or json5
+	segs []Span
+}
+
+// unwrapMarkdown takes the document out of a chat message for
+// Options.UnwrapMarkdown. It uses, in order of preference, the first fenced
+// code block tagged json, jsonc or json5, the first fenced block containing
+// '{' or '[', or the first inline code span starting with one. Blockquote
+// prefixes ("> ") and Discord spoiler bars ("||") around fences or the
+// whole message are removed. Input without code but with blockquote
+// prefixes is unquoted.
+//
+// The returned span is the part of in the document was taken from; it is
+// zero when in is returned unchanged. A rewrite adds a pass to trace.
+func unwrapMarkdown(in []byte, trace *offsetTrace) ([]byte, Span) {
+	var (
+		fences  []mdFence
+		open    *mdFence
+		openRun []byte
+		quoted  bool
+		lines   []Span // every line without its blockquote prefix
+	)
+	for ls := 0; ls < len(in); {
+		le := len(in)
+		if i := bytes.IndexByte(in[ls:], '\n'); i >= 0 {
+			le = ls + i + 1
+		}
+		cs := ls + quotePrefix(in[ls:le])
+		if cs > ls {
+			quoted = true
+		}
+		line := Span{cs, le}
+		lines = append(lines, line)
+		content := in[cs:le]
+		switch {
+		case open != nil:
+			if closesFence(content, openRun) {
+				open = nil
+			} else {
+				open.segs = append(open.segs, line)
+			}
+		default:
+			if run, info, ok := opensFence(content); ok {
+				tag := string(bytes.ToLower(firstWord(info)))
+				fences = append(fences, mdFence{json: tag == "json" || tag == "jsonc" || tag == "json5"})
+				open, openRun = &fences[len(fences)-1], run
+			}
+		}
+		ls = le
+	}
+
+	var segs []Span
+	for _, f := range fences {
+		if f.json {
+			segs = f.segs
+			break
+		}
+	}
+	if segs == nil {
+		for _, f := range fences {
+			if segsContain(in, f.segs, "{[") {
+				segs = f.segs
+				break
+			}
+		}
+	}
+	if segs == nil {
+		if s, ok := inlineCode(in); ok {
+			segs = []Span{s}
+		} else if s, ok := spoiler(in); ok {
+			segs = []Span{s}
+		} else if quoted {
+			segs = lines
+		}
+	}
+	if len(segs) == 0 {
+		return in, Span{}
+	}
+	if len(segs) == 1 {
+		// One span needs no copy: the pass only shifts offsets.
+		trace.shift(segs[0].Start)
+		return in[segs[0].Start:segs[0].End], segs[0]
+	}
+	m := trace.pass()
+	out := make([]byte, 0, segs[len(segs)-1].End-segs[0].Start)
+	for _, s := range segs {
+		m.mark(len(out), s.Start)
+		out = append(out, in[s.Start:s.End]...)
+	}
+	return out, Span{segs[0].Start, segs[len(segs)-1].End}
+}
+
+// quotePrefix returns the length of the blockquote markers, up to three
+// spaces then '>' and an optional space, repeated, that start line.
+func quotePrefix(line []byte) int {
+	n := 0
+	for {
+		i := n
+		for i < len(line) && i-n < 3 && line[i] == ' ' {
+			i++
+		}
+		if i == len(line) || line[i] != '>' {
+			return n
+		}
+		i++
+		if i < len(line) && line[i] == ' ' {
+			i++
+		}
+		n = i
+	}
+}
+
+// opensFence reports whether line opens a fenced code block, optionally
+// behind a spoiler bar, and returns its fence run and info string.
+func opensFence(line []byte) (run, info []byte, ok bool) {
+	line = bytes.TrimLeft(bytes.TrimPrefix(bytes.TrimLeft(line, " \t"), []byte("||")), " \t")
+	run = fenceRun(line)
+	if run == nil {
+		return nil, nil, false
+	}
+	info = bytes.TrimSpace(line[len(run):])
+	if run[0] == '`' && bytes.IndexByte(info, '`') >= 0 {
+		// A one-line ```code``` span, left to inlineCode.
+		return nil, nil, false
+	}
+	return run, info, true
+}
+
+// closesFence reports whether line closes the fence opened by run,
+// optionally followed by a spoiler bar.
+func closesFence(line []byte, run []byte) bool {
+	line = bytes.TrimSpace(line)
+	line = bytes.TrimSpace(bytes.TrimSuffix(line, []byte("||")))
+	r := fenceRun(line)
+	return r != nil && r[0] == run[0] && len(r) >= len(run) && len(r) == len(line)
+}
+
+// fenceRun returns the run of three or more '`' or '~' line starts with.
+func fenceRun(line []byte) []byte {
+	if len(line) == 0 || (line[0] != '`' && line[0] != '~') {
+		return nil
+	}
+	n := 1
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	if n < 3 {
+		return nil
+	}
+	return line[:n]
+}
+
+func firstWord(b []byte) []byte {
+	if i := bytes.IndexAny(b, " \t{"); i >= 0 {
+		return b[:i]
+	}
+	return b
+}
+
+func segsContain(in []byte, segs []Span, chars string) bool {
+	for _, s := range segs {
+		if bytes.ContainsAny(in[s.Start:s.End], chars) {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineCode finds the first code span, delimited by equal runs of
+// backticks, whose content starts with '{' or '['. Backticks are only
+// looked for outside JSON strings, and there is no span when a balanced
+// object or array is outside code spans: the input is then a document that
+// mentions code, not a message that quotes one.
+func inlineCode(in []byte) (Span, bool) {
+	var (
+		code  Span
+		found bool
+		depth int // of brackets outside code spans
+	)
+	lx := newTolerantLexer(in, 0, false)
+	for t := lx.next(); t.kind != tokEOF; t = lx.next() {
+		switch t.kind {
+		case tokPunct:
+			switch in[t.start] {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth > 0 {
+					if depth--; depth == 0 {
+						return Span{}, false
+					}
+				}
+			}
+		case tokJunk:
+			j := bytes.IndexByte(in[t.start:t.end], '`')
+			if j < 0 {
+				continue
+			}
+			start := t.start + j
+			n := 1
+			for start+n < len(in) && in[start+n] == '`' {
+				n++
+			}
+			end := closingRun(in, start+n, n)
+			if end < 0 {
+				lx = newTolerantLexer(in, start+n, false)
+				continue
+			}
+			content := Span{start + n, end}
+			trimmed := bytes.TrimSpace(in[content.Start:content.End])
+			if !found && len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+				code, found = content, true
+			}
+			lx = newTolerantLexer(in, end+n, false)
+		}
+	}
+	return code, found
+}
+
+// spoiler returns the contents of a message wrapped whole in Discord
+// spoiler bars, as in "||{...}||".
+func spoiler(in []byte) (Span, bool) {
+	s, e := 0, len(in)
+	for s < e && isSpace(in[s]) {
+		s++
+	}
+	for e > s && isSpace(in[e-1]) {
+		e--
+	}
+	if e-s < 4 || !bytes.HasPrefix(in[s:e], []byte("||")) || !bytes.HasSuffix(in[s:e], []byte("||")) {
+		return Span{}, false
+	}
+	return Span{s + 2, e - 2}, true
+}
+
+// closingRun returns the offset of the first run of exactly n backticks at
+// or after from, or -1.
+func closingRun(in []byte, from, n int) int {
+	for i := from; i < len(in); {
+		j := bytes.IndexByte(in[i:], '`')
+		if j < 0 {
+			return -1
+		}
+		s := i + j
+		e := s
+		for e < len(in) && in[e] == '`' {
+			e++
+		}
+		if e-s == n {
+			return s
+		}
+		i = e
+	}
+	return -1
+}
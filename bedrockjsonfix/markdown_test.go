@@ -0,0 +1,141 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnwrapMarkdown(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty = false
+	opt.UnwrapMarkdown = true
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		span  string
+	}{
+		{
+			name:  "json fence preferred",
+			input: "try {this}:\n```js\nlet a = [1]\n```\nmy file:\n```json\n{\"a\": 1,}\n```\nthanks {x}",
+			want:  `{"a":1}`,
+			span:  "{\"a\": 1,}\n",
+		},
+		{
+			name:  "untagged fence with brackets",
+			input: "```\nno json\n```\n~~~~\n[1, 2]\n~~~~\n",
+			want:  `[1,2]`,
+			span:  "[1, 2]\n",
+		},
+		{
+			name:  "blockquote and spoiler",
+			input: "> look:\n> ||```jsonc\n> {\n>   \"a\": 1 // one\n> }\n> ```||\n",
+			want:  `{"a":1}`,
+			span:  "{\n>   \"a\": 1 // one\n> }\n",
+		},
+		{
+			name:  "inline code",
+			input: "it says `manifest.json` has `{\"b\": [true,]}` in it {",
+			want:  `{"b":[true]}`,
+			span:  `{"b": [true,]}`,
+		},
+		{
+			name:  "one-line fence",
+			input: "```{\"c\": 3}``` [",
+			want:  `{"c":3}`,
+			span:  `{"c": 3}`,
+		},
+		{
+			name:  "quoted document",
+			input: "> {\"d\":\n> 4}\n",
+			want:  `{"d":4}`,
+			span:  "{\"d\":\n> 4}\n",
+		},
+		{
+			name:  "backticks in strings",
+			input: "{\"desc\": \"use `[x]` here\", // c\n \"a\": 1}",
+			want:  "{\"desc\":\"use `[x]` here\",\"a\":1}",
+		},
+		{
+			name:  "root outside code spans",
+			input: "{\"note\": \"see below\"} and `[2]`",
+			want:  `{"note":"see below"}`,
+		},
+		{
+			name:  "spoiler around the message",
+			input: " ||{\"f\": 6}||\n",
+			want:  `{"f":6}`,
+			span:  `{"f": 6}`,
+		},
+		{
+			name:  "unclosed fence",
+			input: "```json\n{\"e\": 5}",
+			want:  `{"e":5}`,
+			span:  `{"e": 5}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := FixString(tt.input, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSuffix(string(res.Output), "\n"); got != tt.want {
+				t.Fatalf("output = %q, want %q", got, tt.want)
+			}
+			sp := res.Report.Markdown
+			if got := tt.input[sp.Start:sp.End]; got != tt.span {
+				t.Fatalf("span %+v = %q, want %q", sp, got, tt.span)
+			}
+			if unwrapped := res.Report.Repairs&RepairMarkdown != 0; unwrapped != (tt.span != "") {
+				t.Fatalf("Repairs = %v with span %q", res.Report.Repairs, tt.span)
+			}
+		})
+	}
+}
+
+func TestUnwrapMarkdownErrorPosition(t *testing.T) {
+	opt := DefaultOptions()
+	opt.UnwrapMarkdown = true
+	_, err := FixString("> hi\n> ```json\n> {\"a\": 1\n> \"b\": 2}\n> ```\n", opt)
+	var fe *FixError
+	if !errors.As(err, &fe) {
+		t.Fatalf("error = %v, want a FixError", err)
+	}
+	if fe.Line != 4 || fe.Column != 3 {
+		t.Fatalf("error at %d:%d, want 4:3 in the original message", fe.Line, fe.Column)
+	}
+}
+
+func TestUnwrapMarkdownRisk(t *testing.T) {
+	opt := DefaultOptions()
+	opt.UnwrapMarkdown = true
+	opt.MaxRisk = RiskCosmetic
+	if _, err := FixString("see:\n```json\n{\"a\":1}\n```", opt); !errors.Is(err, ErrRepairTooLossy) {
+		t.Fatalf("error = %v, want ErrRepairTooLossy", err)
+	}
+	opt.MaxRisk = RiskStructural
+	res, err := FixString("||{\"a\":1}||", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Report.Repairs != RepairMarkdown || len(res.Warnings) != 1 || res.Warnings[0].Code != WarnMarkdownUnwrapped {
+		t.Fatalf("Repairs = %v, Warnings = %+v", res.Report.Repairs, res.Warnings)
+	}
+}
+
+func TestUnwrapMarkdownOff(t *testing.T) {
+	res, err := FixString("```json\n{\"a\":1}\n```", DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Report.Markdown != (Span{}) {
+		t.Fatalf("Markdown = %+v without UnwrapMarkdown", res.Report.Markdown)
+	}
+	opt := DefaultStreamOptions()
+	opt.UnwrapMarkdown = true
+	if err := streamUnsupported(opt); !errors.Is(err, ErrStreamUnsupported) {
+		t.Fatalf("streamUnsupported = %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package bedrockjsonfix
+
+import "sort"
+
+// offsetAnchor pins a byte in a rewritten buffer (dst) to the byte of the
+// source buffer it was produced from (src).
+type offsetAnchor struct {
+	dst int
+	src int
+}
+
+// offsetMap records the anchors of one rewriting pass. Anchors are appended in
+// increasing dst order; offsets between two anchors map linearly. An empty map
+// is the identity.
+type offsetMap []offsetAnchor
+
+func (m *offsetMap) mark(dst, src int) {
+	if m == nil {
+		return
+	}
+	*m = append(*m, offsetAnchor{dst: dst, src: src})
+}
+
+func (m offsetMap) origin(dst int) int {
+	i := sort.Search(len(m), func(i int) bool { return m[i].dst > dst })
+	if i == 0 {
+		return dst
+	}
+	a := m[i-1]
+	return a.src + dst - a.dst
+}
+
+// offsetTrace chains the offset maps of every pass applied to the input so an
+// offset in the final candidate can be traced back to the original bytes.
+// A nil trace disables tracking.
+type offsetTrace struct {
+	steps []*offsetMap
+}
+
+// reset empties the trace but keeps its maps for reuse by pass.
+func (t *offsetTrace) reset() {
+	t.steps = t.steps[:0]
+}
+
+func (t *offsetTrace) pass() *offsetMap {
+	if t == nil {
+		return nil
+	}
+	if n := len(t.steps); n < cap(t.steps) {
+		if m := t.steps[:n+1][n]; m != nil {
+			*m = (*m)[:0]
+			t.steps = t.steps[:n+1]
+			return m
+		}
+	}
+	m := new(offsetMap)
+	t.steps = append(t.steps, m)
+	return m
+}
+
+func (t *offsetTrace) shift(n int) {
+	if t == nil || n == 0 {
+		return
+	}
+	t.pass().mark(0, n)
+}
+
+func (t *offsetTrace) len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.steps)
+}
+
+func (t *offsetTrace) truncate(n int) {
+	if t == nil {
+		return
+	}
+	t.steps = t.steps[:n]
+}
+
+func (t *offsetTrace) origin(off int) int {
+	if t == nil {
+		return off
+	}
+	return t.originBefore(len(t.steps), off)
+}
+
+// originBefore traces off back through the first n passes only, for an
+// offset into the buffer pass n was applied to.
+func (t *offsetTrace) originBefore(n, off int) int {
+	for i := n - 1; i >= 0; i-- {
+		off = t.steps[i].origin(off)
+	}
+	return off
+}
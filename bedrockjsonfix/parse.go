@@ -2,49 +2,230 @@ package bedrockjsonfix
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
-	"io"
 )
 
-func parseAndMarshal(input []byte, opt Options) ([]byte, RootKind, error) {
-	out, kind, _, err := parseAndMarshalWithParsed(input, opt)
-	return out, kind, err
+// trailingDataError reports a second document after the first one.
+type trailingDataError struct {
+	Offset int64
 }
 
-func parseAndMarshalWithParsed(input []byte, opt Options) ([]byte, RootKind, any, error) {
+func (e *trailingDataError) Error() string { return "multiple documents" }
+
+// emitDocument validates input as a single strict JSON document and appends
+// it to dst with the indentation configured in opt. Errors are *emitError or
+// *trailingDataError carrying offsets into input, or the cancellation of
+// ctx. sc may be nil.
+func emitDocument(ctx context.Context, dst, input []byte, opt Options, sc *fixScratch) ([]byte, RootKind, error) {
+	if dst == nil {
+		dst = make([]byte, 0, len(input)+len(input)/4+1)
+	}
+	em := newEmitter(opt)
+	em.out = dst
+	em.ctx = ctx
+	if sc != nil && opt.Output == OutputJSONC {
+		em.notes = &sc.jsonc
+	}
+	if sc != nil {
+		em.stack, em.scratch, em.counts = sc.emitStack[:0], sc.emitText[:0], sc.counts[:0]
+	}
+	err := em.document(input)
+	if sc != nil {
+		sc.emitStack, sc.emitText, sc.counts = em.stack[:0], em.scratch[:0], em.counts[:0]
+	}
+	return em.out, em.root, err
+}
+
+// checkDocument is emitDocument for runs that need the outcome but not the
+// output, such as Lint. Documents scanStrict accepts are valid as they are;
+// anything else is emitted after all, so the error is the one emitDocument
+// returns.
+func checkDocument(ctx context.Context, input []byte, opt Options, sc *fixScratch) (RootKind, error) {
+	kind, ok := scanStrict(ctx, input, limitsFromOptions(opt), sc)
+	if ok {
+		return kind, nil
+	}
+	_, kind, err := emitDocument(ctx, nil, input, opt, sc)
+	return kind, err
+}
+
+// scanStrict checks plain strict JSON within lim in one pass over the
+// bytes, following the states of the emitter without its lexer. It only
+// accepts documents the emitter accepts, but may refuse some of those too,
+// such as documents with comments left for the lexer to report, so false
+// only means the emitter has to decide.
+func scanStrict(ctx context.Context, in []byte, lim emitLimits, sc *fixScratch) (RootKind, bool) {
+	stack, counts := sc.emitStack[:0], sc.counts[:0]
+	defer func() { sc.emitStack, sc.counts = stack[:0], counts[:0] }()
+	kind, state, tokens := RootUnknown, emitRoot, 0
+	nextCheck := cancelCheckBytes
+	// value starts a value in the current state, counting it as an array
+	// element when it is one.
+	value := func() bool {
+		switch state {
+		case emitRoot, emitMemberValue:
+			return true
+		case emitArrayStart, emitArrayValue:
+			counts[len(counts)-1]++
+			return lim.elements <= 0 || counts[len(counts)-1] <= lim.elements
+		}
+		return false
+	}
+	endValue := func() {
+		if len(stack) == 0 {
+			state = emitDone
+		} else {
+			state = emitAfterValue
+		}
+	}
+	for i := 0; i < len(in); {
+		c := in[i]
+		if isSpace(c) {
+			i++
+			continue
+		}
+		if i >= nextCheck {
+			if ctx != nil && ctx.Err() != nil {
+				return kind, false
+			}
+			nextCheck = i + cancelCheckBytes
+		}
+		tokens++
+		if lim.tokens > 0 && tokens > lim.tokens {
+			return kind, false
+		}
+		switch c {
+		case '{', '[':
+			if !value() || lim.depth > 0 && len(stack) >= lim.depth {
+				return kind, false
+			}
+			if state == emitRoot {
+				kind = RootArray
+				if c == '{' {
+					kind = RootObject
+				}
+			}
+			stack = append(stack, c)
+			counts = append(counts, 0)
+			state = emitArrayStart
+			if c == '{' {
+				state = emitObjectStart
+			}
+			i++
+		case '}', ']':
+			open := byte('[')
+			if c == '}' {
+				open = '{'
+			}
+			if len(stack) == 0 || stack[len(stack)-1] != open {
+				return kind, false
+			}
+			if state != emitAfterValue && state != emitObjectStart && state != emitArrayStart {
+				return kind, false
+			}
+			stack, counts = stack[:len(stack)-1], counts[:len(counts)-1]
+			endValue()
+			i++
+		case ':':
+			if state != emitColon {
+				return kind, false
+			}
+			state = emitMemberValue
+			i++
+		case ',':
+			if state != emitAfterValue {
+				return kind, false
+			}
+			state = emitArrayValue
+			if stack[len(stack)-1] == '{' {
+				state = emitObjectKey
+			}
+			i++
+		case '"':
+			j, plain := i+1, true
+			for j < len(in) && in[j] != '"' {
+				if in[j] == '\\' {
+					plain = false
+					j++
+				} else if in[j] < 0x20 {
+					return kind, false
+				}
+				j++
+			}
+			if j >= len(in) {
+				return kind, false
+			}
+			j++
+			raw := in[i:j]
+			key := state == emitObjectStart || state == emitObjectKey
+			if key {
+				counts[len(counts)-1]++
+				if lim.members > 0 && counts[len(counts)-1] > lim.members {
+					return kind, false
+				}
+			} else if !value() {
+				return kind, false
+			}
+			if lim.stringBytes > 0 && len(raw)-2 > lim.stringBytes || !plain && checkJSONString(raw) != nil {
+				return kind, false
+			}
+			if key {
+				state = emitColon
+			} else {
+				endValue()
+			}
+			i = j
+		default:
+			j := i
+			for j < len(in) && !isStrictDelimiter(in[j]) {
+				j++
+			}
+			raw := in[i:j]
+			switch string(raw) {
+			case "true", "false", "null":
+			default:
+				if !isJSONNumber(raw) {
+					return kind, false
+				}
+			}
+			if !value() {
+				return kind, false
+			}
+			endValue()
+			i = j
+		}
+	}
+	return kind, state == emitDone
+}
+
+// isStrictDelimiter reports whether c ends a number or literal in strict
+// JSON.
+func isStrictDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', ',', ':', '[', ']', '{', '}', '"':
+		return true
+	}
+	return false
+}
+
+// maxCompactOutput bounds the compact output emitDocument writes for n
+// input bytes: re-encoding a string turns one byte into at most six, as
+// in "<" to "\u003c", and the document ends with a newline.
+func maxCompactOutput(n int) int64 {
+	return 6*int64(n) + 1
+}
+
+// decodeTree decodes a validated document into the generic tree passed to
+// RootValidator.
+func decodeTree(input []byte) (any, error) {
 	dec := json.NewDecoder(bytes.NewReader(input))
 	dec.UseNumber()
 	var v any
 	if err := dec.Decode(&v); err != nil {
-		return nil, RootUnknown, nil, err
+		return nil, err
 	}
-	var trailing any
-	if err := dec.Decode(&trailing); err != io.EOF {
-		if err == nil {
-			return nil, RootUnknown, nil, errors.New("multiple documents")
-		}
-		return nil, RootUnknown, nil, err
-	}
-	kind := RootUnknown
-	switch v.(type) {
-	case map[string]any:
-		kind = RootObject
-	case []any:
-		kind = RootArray
-	}
-	var out []byte
-	var err error
-	if opt.Pretty {
-		out, err = json.MarshalIndent(v, opt.Prefix, opt.Indent)
-	} else {
-		out, err = json.Marshal(v)
-	}
-	if err != nil {
-		return nil, RootUnknown, nil, err
-	}
-	out = append(out, '\n')
-	return out, kind, v, nil
+	return v, nil
 }
 
 func strictJSONSingleDocument(input []byte) (bool, RootKind) {
@@ -61,6 +242,26 @@ func strictJSONSingleDocument(input []byte) (bool, RootKind) {
 	}
 }
 
+// validDocument is strictJSONSingleDocument using the emitter grammar and
+// the buffers in sc, so it does not allocate in steady state even when
+// input is invalid. The structural limits of opt apply; a violation is
+// returned as an *emitError with its offset in input.
+func validDocument(input []byte, opt Options, sc *fixScratch) (bool, RootKind, error) {
+	em := newEmitter(Options{})
+	em.lim = limitsFromOptions(opt)
+	em.discard = true
+	em.out, em.stack, em.counts = sc.check[:0], sc.emitStack[:0], sc.counts[:0]
+	err := em.document(input)
+	sc.check, sc.emitStack, sc.counts = em.out[:0], em.stack[:0], em.counts[:0]
+	if _, ok := asLimitError(err); ok {
+		return false, RootUnknown, err
+	}
+	if err != nil {
+		return false, RootUnknown, nil
+	}
+	return true, em.root, nil
+}
+
 func firstJSONToken(input []byte) byte {
 	for _, c := range input {
 		if !isSpace(c) {
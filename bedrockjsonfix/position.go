@@ -0,0 +1,45 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Position is a location in the original input.
+type Position struct {
+	// Offset is the zero-based byte offset.
+	Offset int
+	// Line is the one-based line number. Lines are separated by '\n'.
+	Line int
+	// Column is the one-based character column within the line. Bytes that
+	// are not valid UTF-8 count as one character each, matching CP1252 input.
+	Column int
+}
+
+func positionAt(input []byte, off int) Position {
+	if off < 0 {
+		off = 0
+	}
+	if off > len(input) {
+		off = len(input)
+	}
+	head := input[:off]
+	lineStart := bytes.LastIndexByte(head, '\n') + 1
+	return Position{
+		Offset: off,
+		Line:   bytes.Count(head, []byte{'\n'}) + 1,
+		Column: utf8.RuneCount(head[lineStart:]) + 1,
+	}
+}
+
+// advancePosition returns the position just after b when b starts at p.
+func advancePosition(p Position, b []byte) Position {
+	p.Offset += len(b)
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		p.Line += bytes.Count(b, []byte{'\n'})
+		p.Column = utf8.RuneCount(b[i+1:]) + 1
+	} else {
+		p.Column += utf8.RuneCount(b)
+	}
+	return p
+}
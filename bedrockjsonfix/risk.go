@@ -0,0 +1,239 @@
+package bedrockjsonfix
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// Risk classifies how much a repair may change the meaning of the input.
+type Risk int
+
+const (
+	// RiskNone means no repair was applied.
+	RiskNone Risk = iota
+	// RiskCosmetic repairs only remove bytes that carry no data (BOM, comments, CRLF).
+	RiskCosmetic
+	// RiskStructural repairs change syntax but keep every value (trailing commas, escaping).
+	RiskStructural
+	// RiskLossy repairs discard or reinterpret data (junk, root scan, encoding guesses).
+	RiskLossy
+)
+
+func (r Risk) String() string {
+	switch r {
+	case RiskNone:
+		return "none"
+	case RiskCosmetic:
+		return "cosmetic"
+	case RiskStructural:
+		return "structural"
+	case RiskLossy:
+		return "lossy"
+	default:
+		return fmt.Sprintf("Risk(%d)", int(r))
+	}
+}
+
+// Repair is a set of repair classes. Each constant is a single flag.
+type Repair uint32
+
+const (
+	// RepairBOM removes a UTF-8 byte order mark (cosmetic).
+	RepairBOM Repair = 1 << iota
+	// RepairCRLF normalizes CR and CRLF outside strings to LF (cosmetic).
+	RepairCRLF
+	// RepairNBSP replaces non-breaking spaces outside strings (cosmetic).
+	RepairNBSP
+	// RepairZeroWidth removes zero-width characters outside strings (cosmetic).
+	RepairZeroWidth
+	// RepairASCIIControls removes control characters outside strings (cosmetic).
+	RepairASCIIControls
+	// RepairLineComments strips // comments (cosmetic).
+	RepairLineComments
+	// RepairBlockComments strips /* */ comments (cosmetic).
+	RepairBlockComments
+	// RepairTrailingCommas removes commas before } or ] (structural).
+	RepairTrailingCommas
+	// RepairStringControls escapes raw control characters inside strings (structural).
+	RepairStringControls
+	// RepairStringNewlines escapes literal newlines inside strings (structural).
+	RepairStringNewlines
+	// RepairLeadingJunk trims data before the root value (lossy).
+	RepairLeadingJunk
+	// RepairCP1252 decodes invalid UTF-8 as Windows-1252 (lossy).
+	RepairCP1252
+	// RepairStringWhitespace changes NBSP or zero-width characters inside strings (lossy).
+	RepairStringWhitespace
+	// RepairDropJunk drops non-JSON bytes outside strings (lossy).
+	RepairDropJunk
+	// RepairTrailingJunk trims data after the root value (lossy).
+	RepairTrailingJunk
+	// RepairRootScan falls back to a later root candidate (lossy).
+	RepairRootScan
+	// RepairCodeWrapper extracts the literal from a JavaScript wrapper such
+	// as `const x = {...};` or a JSONP callback (structural).
+	RepairCodeWrapper
+	// RepairStringJSON decodes a document sent as a JSON string, for
+	// Options.UnwrapStringEncodedJSON (lossy).
+	RepairStringJSON
+	// RepairMarkdown takes the document out of a Markdown or chat message,
+	// dropping the prose around it, for Options.UnwrapMarkdown (structural).
+	RepairMarkdown
+
+	repairCount = iota
+)
+
+// RepairsBedrock is the repair preset of ModeBedrock: every repair.
+const RepairsBedrock Repair = 1<<repairCount - 1
+
+var repairNames = [repairCount]string{
+	"bom",
+	"crlf",
+	"nbsp",
+	"zero_width",
+	"ascii_controls",
+	"line_comments",
+	"block_comments",
+	"trailing_commas",
+	"string_controls",
+	"string_newlines",
+	"leading_junk",
+	"cp1252",
+	"string_whitespace",
+	"drop_junk",
+	"trailing_junk",
+	"root_scan",
+	"code_wrapper",
+	"string_json",
+	"markdown",
+}
+
+var repairRisks = [repairCount]Risk{
+	RiskCosmetic,
+	RiskCosmetic,
+	RiskCosmetic,
+	RiskCosmetic,
+	RiskCosmetic,
+	RiskCosmetic,
+	RiskCosmetic,
+	RiskStructural,
+	RiskStructural,
+	RiskStructural,
+	RiskLossy,
+	RiskLossy,
+	RiskLossy,
+	RiskLossy,
+	RiskLossy,
+	RiskLossy,
+	RiskStructural,
+	RiskLossy,
+	RiskStructural,
+}
+
+// Risk returns the highest risk of the repairs in the set.
+func (r Repair) Risk() Risk {
+	risk := RiskNone
+	for r != 0 {
+		i := bits.TrailingZeros32(uint32(r))
+		if i < repairCount && repairRisks[i] > risk {
+			risk = repairRisks[i]
+		}
+		r &^= 1 << i
+	}
+	return risk
+}
+
+// String lists the repair names in the set, separated by commas.
+func (r Repair) String() string {
+	if r == 0 {
+		return "none"
+	}
+	var names []string
+	for r != 0 {
+		i := bits.TrailingZeros32(uint32(r))
+		if i < repairCount {
+			names = append(names, repairNames[i])
+		} else {
+			names = append(names, fmt.Sprintf("Repair(%#x)", uint32(1)<<i))
+		}
+		r &^= 1 << i
+	}
+	return strings.Join(names, ",")
+}
+
+// junkTally counts the bytes other than whitespace among the bytes trimmed
+// before and after the root. Report counts every trimmed byte, but trimming
+// whitespace alone is not a junk repair.
+type junkTally struct {
+	leading, trailing int
+}
+
+// trim adds the bytes trimRep trimmed from both ends of b.
+func (j *junkTally) trim(b []byte, trimRep Report) {
+	j.leading += nonSpaceBytes(b[:trimRep.TrimmedLeadingJunkBytes])
+	j.trailing += nonSpaceBytes(b[len(b)-trimRep.TrimmedTrailingJunkBytes:])
+}
+
+// appliedRepairs returns the set of repairs with a non-zero counter.
+func appliedRepairs(rep Report, junk junkTally) Repair {
+	var r Repair
+	set := func(flag Repair, applied bool) {
+		if applied {
+			r |= flag
+		}
+	}
+	set(RepairBOM, rep.RemovedBOM > 0)
+	set(RepairCRLF, rep.NormalizedCRLF > 0)
+	set(RepairNBSP, rep.ReplacedNBSP > rep.ReplacedNBSPInStrings)
+	set(RepairZeroWidth, rep.RemovedZeroWidth > rep.RemovedZeroWidthInStrings)
+	set(RepairASCIIControls, rep.RemovedASCIIControls > 0)
+	set(RepairLineComments, rep.StrippedLineComments > 0)
+	set(RepairBlockComments, rep.StrippedBlockComments > 0)
+	set(RepairTrailingCommas, rep.RemovedTrailingCommas > 0)
+	set(RepairStringControls, rep.EscapedStringControls > 0)
+	set(RepairStringNewlines, rep.NormalizedNewlinesInStrings > 0)
+	set(RepairLeadingJunk, junk.leading > 0)
+	set(RepairCP1252, rep.UsedCP1252Fallback)
+	set(RepairStringWhitespace, rep.ReplacedNBSPInStrings > 0 || rep.RemovedZeroWidthInStrings > 0)
+	set(RepairDropJunk, rep.DroppedJunkOutsideStrings > 0)
+	set(RepairTrailingJunk, junk.trailing > 0)
+	set(RepairRootScan, rep.RootScanUsed)
+	set(RepairCodeWrapper, rep.CodeWrapper != "")
+	set(RepairStringJSON, rep.UnwrappedStringLayers > 0)
+	set(RepairMarkdown, rep.Markdown != (Span{}))
+	return r
+}
+
+// classifyRepairs fills the repair set and risk summary of a finished report.
+func classifyRepairs(rep *Report, junk junkTally) {
+	rep.Repairs = appliedRepairs(*rep, junk)
+	rep.Risk = rep.Repairs.Risk()
+}
+
+// checkRisk enforces MaxRisk and MaxDroppedJunkBytes on a finished report.
+func checkRisk(rep Report, junk junkTally, opt Options) error {
+	if opt.MaxRisk != RiskNone && rep.Risk > opt.MaxRisk {
+		var over Repair
+		for r := rep.Repairs; r != 0; r &= r - 1 {
+			flag := r & -r
+			if flag.Risk() > opt.MaxRisk {
+				over |= flag
+			}
+		}
+		return &FixError{Code: "repair_too_lossy", Message: fmt.Sprintf("repair risk %s exceeds limit %s (%s)", rep.Risk, opt.MaxRisk, over), Cause: ErrRepairTooLossy}
+	}
+	return checkDroppedJunk(rep, junk, opt)
+}
+
+// checkDroppedJunk enforces MaxDroppedJunkBytes. Trimmed whitespace is not
+// counted.
+func checkDroppedJunk(rep Report, junk junkTally, opt Options) error {
+	if opt.MaxDroppedJunkBytes > 0 {
+		dropped := int64(rep.DroppedJunkOutsideStrings) + int64(junk.leading) + int64(junk.trailing)
+		if dropped > opt.MaxDroppedJunkBytes {
+			return &FixError{Code: "repair_too_lossy", Message: fmt.Sprintf("dropped junk bytes exceed limit (%d > %d)", dropped, opt.MaxDroppedJunkBytes), Cause: ErrRepairTooLossy}
+		}
+	}
+	return nil
+}
@@ -97,6 +97,10 @@ func isLikelyWrongRootStart(parseErr error, maxOffset int64) bool {
 	if parseErr == nil {
 		return false
 	}
+	var emit *emitError
+	if errors.As(parseErr, &emit) {
+		return !emit.eof && int64(emit.offset) < maxOffset
+	}
 	var syn *json.SyntaxError
 	if errors.As(parseErr, &syn) {
 		return syn.Offset > 0 && syn.Offset <= maxOffset
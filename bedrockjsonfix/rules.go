@@ -0,0 +1,301 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// RuleScope selects the part of the input a Rule rewrites.
+type RuleScope string
+
+const (
+	// ScopeOutsideStrings matches the text between strings and comments,
+	// one run at a time.
+	ScopeOutsideStrings RuleScope = "outside_strings"
+	// ScopeInsideStrings matches the content of strings, without the quotes.
+	ScopeInsideStrings RuleScope = "inside_strings"
+	// ScopeKey matches a string, number, literal or bare word followed by
+	// ':'. The quotes of a string are not part of the match.
+	ScopeKey RuleScope = "key"
+	// ScopeValue matches a string, number, literal or bare word that is not
+	// a key. The quotes of a string are not part of the match.
+	ScopeValue RuleScope = "value"
+)
+
+// Rule is one replacement of a rule file. Exactly one of Literal and Regex
+// is set. Regex uses RE2 syntax and Replace may refer to its groups as in
+// regexp.Regexp.Expand; a Literal match is replaced by Replace verbatim.
+type Rule struct {
+	ID      string    `json:"id"`
+	Scope   RuleScope `json:"scope"`
+	Literal string    `json:"literal,omitempty"`
+	Regex   string    `json:"regex,omitempty"`
+	Replace string    `json:"replace"`
+}
+
+// RuleHit counts the matches of one rule in Report.Rules.
+type RuleHit struct {
+	ID   string
+	Hits int
+}
+
+// RuleSet is a compiled rule file. It is a Stage and is safe for concurrent
+// use.
+//
+// A rule file is a JSON object; comments and trailing commas are accepted:
+//
+//	{
+//	  "name": "moderation",      // Report.Stages name, default "rules"
+//	  "after": "decode",         // or "before"; "decode" or "cleanup"
+//	  "rules": [
+//	    {"id": "py-true", "scope": "value", "literal": "True", "replace": "true"},
+//	    {"id": "semicolons", "scope": "outside_strings", "literal": ";", "replace": ","}
+//	  ]
+//	}
+//
+// The outside_strings and inside_strings rules run first, then the key and
+// value rules on the result. Within a scope rules run in file order over
+// each span, so a later rule sees the text an earlier one produced.
+// Comments are never rewritten.
+type RuleSet struct {
+	name  string
+	at    StageAt
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+type ruleFile struct {
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Rules  []Rule `json:"rules"`
+}
+
+// LoadRules reads and compiles a rule file. Errors wrap ErrRulesInvalid.
+func LoadRules(r io.Reader) (*RuleSet, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &FixError{Code: "invalid_rules", Message: "read rule file: " + err.Error(), Cause: ErrRulesInvalid}
+	}
+	return ParseRules(data)
+}
+
+// ParseRules compiles a rule file. Errors wrap ErrRulesInvalid.
+func ParseRules(data []byte) (*RuleSet, error) {
+	res, err := FixBytes(data, DefaultOptions())
+	if err != nil {
+		return nil, &FixError{Code: "invalid_rules", Message: "rule file is not JSON: " + err.Error(), Cause: ErrRulesInvalid}
+	}
+	var f ruleFile
+	dec := json.NewDecoder(bytes.NewReader(res.Output))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, &FixError{Code: "invalid_rules", Message: "decode rule file: " + err.Error(), Cause: ErrRulesInvalid}
+	}
+	return CompileRules(f.Name, StageAt{Before: f.Before, After: f.After}, f.Rules)
+}
+
+// CompileRules compiles rules into a RuleSet named name and placed at at;
+// at.Stage is ignored. An empty name defaults to "rules" and an empty
+// placement to after StageDecode. Errors wrap ErrRulesInvalid.
+func CompileRules(name string, at StageAt, rules []Rule) (*RuleSet, error) {
+	if name == "" {
+		name = "rules"
+	}
+	if at.Before == "" && at.After == "" {
+		at.After = StageDecode
+	}
+	rs := &RuleSet{name: name, rules: make([]compiledRule, 0, len(rules))}
+	at.Stage = rs
+	if err := validateStages([]StageAt{at}); err != nil {
+		return nil, &FixError{Code: "invalid_rules", Message: err.(*FixError).Message, Cause: ErrRulesInvalid}
+	}
+	rs.at = at
+	seen := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		if err := checkRule(i, r, seen); err != nil {
+			return nil, err
+		}
+		c := compiledRule{Rule: r}
+		if r.Regex != "" {
+			re, err := regexp.Compile(r.Regex)
+			if err != nil {
+				return nil, &FixError{Code: "invalid_rules", Message: fmt.Sprintf("rule %q: %v", r.ID, err), Cause: ErrRulesInvalid}
+			}
+			c.re = re
+		}
+		rs.rules = append(rs.rules, c)
+	}
+	return rs, nil
+}
+
+func checkRule(i int, r Rule, seen map[string]bool) error {
+	var msg string
+	switch {
+	case r.ID == "":
+		msg = fmt.Sprintf("rule %d has no id", i)
+	case seen[r.ID]:
+		msg = fmt.Sprintf("rule %q is defined twice", r.ID)
+	case (r.Literal == "") == (r.Regex == ""):
+		msg = fmt.Sprintf("rule %q must set exactly one of literal and regex", r.ID)
+	}
+	switch r.Scope {
+	case ScopeOutsideStrings, ScopeInsideStrings, ScopeKey, ScopeValue:
+	default:
+		if msg == "" {
+			msg = fmt.Sprintf("rule %q has unknown scope %q", r.ID, r.Scope)
+		}
+	}
+	if msg != "" {
+		return &FixError{Code: "invalid_rules", Message: msg, Cause: ErrRulesInvalid}
+	}
+	seen[r.ID] = true
+	return nil
+}
+
+// Name implements Stage.
+func (rs *RuleSet) Name() string { return rs.name }
+
+// StageAt returns rs at the placement of its rule file, ready to append to
+// Options.Stages.
+func (rs *RuleSet) StageAt() StageAt { return rs.at }
+
+// Apply implements Stage. Each match is one change and is counted under the
+// rule's ID in rep.Rules.
+func (rs *RuleSet) Apply(buf []byte, rep *Report) ([]byte, int, error) {
+	hits := make([]int, len(rs.rules))
+	buf = rs.pass(buf, hits, false)
+	buf = rs.pass(buf, hits, true)
+	changes := 0
+	for i, n := range hits {
+		if n > 0 {
+			addRuleHit(rep, rs.rules[i].ID, n)
+			changes += n
+		}
+	}
+	return buf, changes, nil
+}
+
+// pass rewrites buf with the string rules, whose spans are the runs outside
+// strings and comments and the string contents, or with the positional
+// rules, whose spans are the keys and values. It returns buf itself when
+// no rule matched.
+func (rs *RuleSet) pass(buf []byte, hits []int, positional bool) []byte {
+	var out []byte
+	copied := 0 // buf[:copied] is accounted for in out
+	rewrite := func(start, end int, scope RuleScope) {
+		seg := rs.rewrite(buf[start:end], scope, hits)
+		if sameBytes(seg, buf[start:end]) {
+			return
+		}
+		out = append(append(out, buf[copied:start]...), seg...)
+		copied = end
+	}
+
+	lx := newTolerantLexer(buf, 0, true)
+	run := 0 // start of the current run outside strings and comments
+	for t := lx.next(); t.kind != tokEOF; t = lx.next() {
+		switch t.kind {
+		case tokLineComment, tokBlockComment:
+			if !positional {
+				rewrite(run, t.start, ScopeOutsideStrings)
+			}
+			run = t.end
+		case tokString:
+			start, end := t.start+1, t.end
+			if t.flags&flagUnterminated == 0 {
+				end--
+			}
+			if positional {
+				rewrite(start, end, tokenScope(buf, lx))
+			} else {
+				rewrite(run, t.start, ScopeOutsideStrings)
+				rewrite(start, end, ScopeInsideStrings)
+			}
+			run = t.end
+		case tokNumber, tokLiteral, tokJunk:
+			if positional {
+				rewrite(t.start, t.end, tokenScope(buf, lx))
+			}
+		}
+	}
+	if !positional {
+		rewrite(run, len(buf), ScopeOutsideStrings)
+	}
+	if out == nil {
+		return buf
+	}
+	return append(out, buf[copied:]...)
+}
+
+// tokenScope returns ScopeKey when the token lx just returned is followed
+// by ':', skipping whitespace and comments, and ScopeValue otherwise.
+func tokenScope(buf []byte, lx tolerantLexer) RuleScope {
+	t := lx.next()
+	for t.kind == tokWhitespace || t.kind == tokLineComment || t.kind == tokBlockComment {
+		t = lx.next()
+	}
+	if t.kind == tokPunct && buf[t.start] == ':' {
+		return ScopeKey
+	}
+	return ScopeValue
+}
+
+// rewrite applies the rules of scope to seg in order. It returns seg itself
+// when no rule matched.
+func (rs *RuleSet) rewrite(seg []byte, scope RuleScope, hits []int) []byte {
+	for i := range rs.rules {
+		r := &rs.rules[i]
+		if r.Scope != scope || len(seg) == 0 {
+			continue
+		}
+		var n int
+		if r.re == nil {
+			if n = bytes.Count(seg, []byte(r.Literal)); n > 0 {
+				seg = bytes.ReplaceAll(seg, []byte(r.Literal), []byte(r.Replace))
+			}
+		} else {
+			seg, n = expandAll(r.re, seg, r.Replace)
+		}
+		hits[i] += n
+	}
+	return seg
+}
+
+// expandAll replaces every non-empty match of re in src with template
+// expanded. It returns src itself when nothing matched.
+func expandAll(re *regexp.Regexp, src []byte, template string) ([]byte, int) {
+	var out []byte
+	last, n := 0, 0
+	for _, m := range re.FindAllSubmatchIndex(src, -1) {
+		if m[0] == m[1] {
+			continue
+		}
+		out = append(out, src[last:m[0]]...)
+		out = re.Expand(out, []byte(template), src, m)
+		last = m[1]
+		n++
+	}
+	if n == 0 {
+		return src, 0
+	}
+	return append(out, src[last:]...), n
+}
+
+func addRuleHit(rep *Report, id string, hits int) {
+	l := rep.editLists()
+	for i := range l.rules {
+		if l.rules[i].ID == id {
+			l.rules[i].Hits += hits
+			return
+		}
+	}
+	l.rules = append(l.rules, RuleHit{ID: id, Hits: hits})
+}
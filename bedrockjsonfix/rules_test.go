@@ -0,0 +1,107 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRuleFile = `{
+  // Bedrock add-ons pasted from Python and word processors.
+  "name": "moderation",
+  "rules": [
+    {"id": "py-true", "scope": "value", "regex": "^True$", "replace": "true"},
+    {"id": "py-none", "scope": "value", "literal": "None", "replace": "null"},
+    {"id": "camel-version", "scope": "key", "regex": "^formatVersion$", "replace": "format_version"},
+    {"id": "curly-apostrophe", "scope": "inside_strings", "literal": "’", "replace": "'"},
+    {"id": "semicolons", "scope": "outside_strings", "literal": ";", "replace": ","},
+  ],
+}`
+
+func TestRuleSetRewritesByScope(t *testing.T) {
+	rs, err := ParseRules([]byte(testRuleFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Name() != "moderation" || rs.StageAt().After != StageDecode {
+		t.Fatalf("unexpected name %q or placement %+v", rs.Name(), rs.StageAt())
+	}
+	opt := DefaultOptions()
+	opt.Pretty = false
+	opt.Stages = []StageAt{rs.StageAt()}
+	in := "{\"formatVersion\": \"1.20\", \"enabled\": True; \"note\": \"don’t; True\", \"x\": None, \"y\": \"formatVersion\"}"
+	res, err := FixString(in, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"format_version":"1.20","enabled":true,"note":"don't; True","x":null,"y":"formatVersion"}` + "\n"
+	if string(res.Output) != want {
+		t.Fatalf("got %s want %s", res.Output, want)
+	}
+	hits := []RuleHit{{"py-true", 1}, {"py-none", 1}, {"camel-version", 1}, {"curly-apostrophe", 1}, {"semicolons", 1}}
+	if !reflect.DeepEqual(res.Report.Rules(), hits) {
+		t.Fatalf("rule hits %+v, want %+v", res.Report.Rules(), hits)
+	}
+	if want := []StageCount{{Name: "moderation", Changes: 5}}; !reflect.DeepEqual(res.Report.Stages(), want) {
+		t.Fatalf("stage counts %+v, want %+v", res.Report.Stages(), want)
+	}
+}
+
+func TestRuleSetLeavesCommentsAndBareKeys(t *testing.T) {
+	rs, err := CompileRules("", StageAt{}, []Rule{
+		{ID: "todo", Scope: ScopeOutsideStrings, Literal: "TODO", Replace: "DONE"},
+		{ID: "bare-key", Scope: ScopeKey, Regex: `^(name)$`, Replace: `"$1"`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep Report
+	out, changes, err := rs.Apply([]byte("{ /* TODO */ name : 1, // TODO\n \"k\": TODO }"), &rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "{ /* TODO */ \"name\" : 1, // TODO\n \"k\": DONE }" || changes != 2 {
+		t.Fatalf("unexpected rewrite %q with %d changes", out, changes)
+	}
+	if rs.Name() != "rules" || rs.StageAt().After != StageDecode {
+		t.Fatalf("unexpected defaults %q %+v", rs.Name(), rs.StageAt())
+	}
+}
+
+func TestRuleSetAfterCleanup(t *testing.T) {
+	rs, err := ParseRules([]byte(`{"after": "cleanup", "rules": [{"id": "one", "scope": "value", "regex": "^1$", "replace": "true"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := DefaultOptions()
+	opt.Pretty = false
+	opt.Stages = []StageAt{rs.StageAt()}
+	res, err := FixString("[1, // 1\n 10, \"1\",]", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Output) != "[true,10,\"true\"]\n" || res.Report.Rules()[0].Hits != 2 {
+		t.Fatalf("unexpected output %q report %+v", res.Output, res.Report.Rules())
+	}
+}
+
+func TestParseRulesRejectsInvalid(t *testing.T) {
+	for _, src := range []string{
+		`{"rules": [{"id": "a", "scope": "everywhere", "literal": "x", "replace": "y"}]}`,
+		`{"rules": [{"id": "a", "scope": "value", "literal": "x", "regex": "x", "replace": "y"}]}`,
+		`{"rules": [{"id": "a", "scope": "value", "replace": "y"}]}`,
+		`{"rules": [{"scope": "value", "literal": "x", "replace": "y"}]}`,
+		`{"rules": [{"id": "a", "scope": "value", "regex": "(", "replace": "y"}]}`,
+		`{"rules": [{"id": "a", "scope": "key", "literal": "x", "replace": ""}, {"id": "a", "scope": "key", "literal": "y", "replace": ""}]}`,
+		`{"before": "parse", "rules": []}`,
+		`{"rulez": []}`,
+		`not a rule file`,
+	} {
+		_, err := LoadRules(strings.NewReader(src))
+		var fe *FixError
+		if !errors.As(err, &fe) || fe.Code != "invalid_rules" || !errors.Is(err, ErrRulesInvalid) {
+			t.Fatalf("%s: expected ErrRulesInvalid, got %v", src, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package bedrockjsonfix
+
+import "fmt"
+
+// TokenKind classifies a Token.
+type TokenKind int
+
+const (
+	// TokenEOF ends the token sequence.
+	TokenEOF TokenKind = iota
+	// TokenPunct is one of { } [ ] : ,
+	TokenPunct
+	// TokenString is a quoted string, including the quotes.
+	TokenString
+	// TokenNumber is a number-like lexeme. It is not checked against the
+	// JSON number grammar.
+	TokenNumber
+	// TokenLiteral is true, false or null.
+	TokenLiteral
+	// TokenComment is a // or /* */ comment.
+	TokenComment
+	// TokenJunk is a run of bytes that cannot start any other token.
+	TokenJunk
+	// TokenWhitespace is a run of whitespace.
+	TokenWhitespace
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenEOF:
+		return "EOF"
+	case TokenPunct:
+		return "punct"
+	case TokenString:
+		return "string"
+	case TokenNumber:
+		return "number"
+	case TokenLiteral:
+		return "literal"
+	case TokenComment:
+		return "comment"
+	case TokenJunk:
+		return "junk"
+	case TokenWhitespace:
+		return "whitespace"
+	}
+	return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// Token is one lexeme of the input.
+type Token struct {
+	Kind TokenKind
+	// Start is the position of the first byte and End the position just
+	// after the last one.
+	Start, End Position
+	// Text is the lexeme. It aliases the scanned input.
+	Text []byte
+	// Repairs is the set of repairs the Bedrock pipeline applies to this
+	// token on its own, such as RepairLineComments for a // comment or
+	// RepairStringNewlines for a string with a raw newline. Repairs that
+	// depend on surrounding tokens, like trailing commas and root trimming,
+	// are not included. Under ModeStrict a token with repairs is invalid.
+	Repairs Repair
+	// Unterminated reports a string or block comment cut off by the end of
+	// input.
+	Unterminated bool
+}
+
+// Scanner splits JSON-ish input into tokens with the tokenizer the repair
+// pipeline uses, so it agrees with FixBytes on where strings, comments and
+// junk begin and end. Under ModeBedrock comments are recognized when a
+// comment repair is enabled, and a BOM, CR, ASCII controls, NBSP and
+// zero-width characters are whitespace. Under ModeStrict only JSON
+// whitespace is whitespace, and anything else that is not a JSON token,
+// including "//" and "/*", is junk.
+type Scanner struct {
+	lx     tolerantLexer
+	strict bool
+	at     Position
+
+	// rest is the part of a whitespace token still to be split under
+	// ModeStrict.
+	rest lexToken
+}
+
+// NewScanner returns a Scanner over input with the semantics of opt.Mode
+// and opt.Fixes.
+func NewScanner(input []byte, opt Options) *Scanner {
+	fixes := opt.effectiveFixes()
+	return &Scanner{
+		lx:     newTolerantLexer(input, 0, fixes&(RepairLineComments|RepairBlockComments) != 0),
+		strict: opt.Mode == ModeStrict,
+		at:     Position{Line: 1, Column: 1},
+	}
+}
+
+// Next returns the next token, or a TokenEOF token at the end of input.
+func (s *Scanner) Next() Token {
+	in := s.lx.in
+	var t lexToken
+	var repairs Repair
+	switch {
+	case s.rest.end > s.rest.start:
+		t = s.splitStrict()
+	case s.lx.pos == 0 && !s.strict && len(in) >= 3 && in[0] == 0xEF && in[1] == 0xBB && in[2] == 0xBF:
+		s.lx.pos = 3
+		t = lexToken{kind: tokWhitespace, start: 0, end: 3}
+		repairs = RepairBOM
+	default:
+		t = s.lx.next()
+		if s.strict && t.kind == tokWhitespace && t.flags&^flagCR != 0 {
+			s.rest = t
+			t = s.splitStrict()
+		}
+	}
+
+	tok := Token{Start: s.at, Text: in[t.start:t.end:t.end], Unterminated: t.flags&flagUnterminated != 0}
+	switch t.kind {
+	case tokEOF:
+		tok.Kind = TokenEOF
+	case tokWhitespace:
+		tok.Kind = TokenWhitespace
+		if !s.strict {
+			repairs |= whitespaceRepairs(t.flags)
+		}
+	case tokLineComment:
+		tok.Kind, repairs = TokenComment, RepairLineComments
+	case tokBlockComment:
+		tok.Kind, repairs = TokenComment, RepairBlockComments
+	case tokString:
+		tok.Kind = TokenString
+		repairs = stringRepairs(t.flags)
+	case tokNumber:
+		tok.Kind = TokenNumber
+	case tokLiteral:
+		tok.Kind = TokenLiteral
+	case tokPunct:
+		tok.Kind = TokenPunct
+	default:
+		tok.Kind, repairs = TokenJunk, RepairDropJunk
+	}
+	tok.Repairs = repairs
+	s.at = advancePosition(s.at, tok.Text)
+	tok.End = s.at
+	return tok
+}
+
+// splitStrict returns the next strict whitespace or junk run of s.rest.
+func (s *Scanner) splitStrict() lexToken {
+	in := s.lx.in
+	i := s.rest.start
+	f, _ := whitespaceFlag(in, i)
+	space := f&^flagCR == 0
+	for i < s.rest.end {
+		f, _ := whitespaceFlag(in, i)
+		if (f&^flagCR == 0) != space {
+			break
+		}
+		i += whitespaceWidth(in[i])
+	}
+	t := lexToken{kind: tokJunk, start: s.rest.start, end: i}
+	if space {
+		t.kind = tokWhitespace
+	}
+	s.rest.start = i
+	return t
+}
+
+func whitespaceRepairs(f tokenFlags) Repair {
+	var r Repair
+	if f&flagCR != 0 {
+		r |= RepairCRLF
+	}
+	if f&flagControl != 0 {
+		r |= RepairASCIIControls
+	}
+	if f&flagNBSP != 0 {
+		r |= RepairNBSP
+	}
+	if f&flagZeroWidth != 0 {
+		r |= RepairZeroWidth
+	}
+	return r
+}
+
+func stringRepairs(f tokenFlags) Repair {
+	var r Repair
+	if f&flagNewline != 0 {
+		r |= RepairStringNewlines
+	}
+	if f&flagControl != 0 {
+		r |= RepairStringControls
+	}
+	if f&(flagNBSP|flagZeroWidth) != 0 {
+		r |= RepairStringWhitespace
+	}
+	return r
+}
@@ -0,0 +1,109 @@
+package bedrockjsonfix
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func scanAll(input string, opt Options) []Token {
+	s := NewScanner([]byte(input), opt)
+	var toks []Token
+	for {
+		tok := s.Next()
+		if tok.Kind == TokenEOF {
+			return toks
+		}
+		toks = append(toks, tok)
+	}
+}
+
+func describeTokens(toks []Token) string {
+	var b strings.Builder
+	for _, tok := range toks {
+		fmt.Fprintf(&b, "%s %d:%d %q", tok.Kind, tok.Start.Line, tok.Start.Column, tok.Text)
+		if tok.Repairs != 0 {
+			fmt.Fprintf(&b, " %s", tok.Repairs)
+		}
+		if tok.Unterminated {
+			b.WriteString(" unterminated")
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestScannerBedrockTokens(t *testing.T) {
+	input := "\xEF\xBB\xBF// é\r\n{\"a\u00a0b\": [1.5e+3, true], x: \"l1\nl2\" /* end"
+	got := describeTokens(scanAll(input, DefaultOptions()))
+	want := `whitespace 1:1 "\ufeff" bom
+comment 1:2 "// é" line_comments
+whitespace 1:6 "\r\n" crlf
+punct 2:1 "{"
+string 2:2 "\"a\u00a0b\"" string_whitespace
+punct 2:7 ":"
+whitespace 2:8 " "
+punct 2:9 "["
+number 2:10 "1.5e+3"
+punct 2:16 ","
+whitespace 2:17 " "
+literal 2:18 "true"
+punct 2:22 "]"
+punct 2:23 ","
+whitespace 2:24 " "
+junk 2:25 "x" drop_junk
+punct 2:26 ":"
+whitespace 2:27 " "
+string 2:28 "\"l1\nl2\"" string_newlines
+whitespace 3:4 " "
+comment 3:5 "/* end" block_comments unterminated
+`
+	if got != want {
+		t.Fatalf("tokens:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestScannerStrictTokens(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Mode = ModeStrict
+	got := describeTokens(scanAll("[1, \u00a0\t2] // c", opt))
+	want := `punct 1:1 "["
+number 1:2 "1"
+punct 1:3 ","
+whitespace 1:4 " "
+junk 1:5 "\u00a0" drop_junk
+whitespace 1:6 "\t"
+number 1:7 "2"
+punct 1:8 "]"
+whitespace 1:9 " "
+junk 1:10 "//" drop_junk
+whitespace 1:12 " "
+junk 1:13 "c" drop_junk
+`
+	if got != want {
+		t.Fatalf("tokens:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestScannerTokensCoverInput(t *testing.T) {
+	input := "junk {\"a\": [1, 2,], /* c */ \"b\": \"\\\"q\\\"\"}\r\n\u200b trailing"
+	for _, mode := range []Mode{ModeBedrock, ModeStrict} {
+		opt := DefaultOptions()
+		opt.Mode = mode
+		end := 0
+		var b strings.Builder
+		for _, tok := range scanAll(input, opt) {
+			if tok.Start.Offset != end || tok.End.Offset != end+len(tok.Text) {
+				t.Fatalf("mode %v: token %q at %d-%d, want start %d", mode, tok.Text, tok.Start.Offset, tok.End.Offset, end)
+			}
+			if want := positionAt([]byte(input), tok.Start.Offset); tok.Start != want {
+				t.Fatalf("mode %v: token %q start %+v, want %+v", mode, tok.Text, tok.Start, want)
+			}
+			end = tok.End.Offset
+			b.Write(tok.Text)
+		}
+		if b.String() != input {
+			t.Fatalf("mode %v: tokens do not reassemble the input: %q", mode, b.String())
+		}
+	}
+}
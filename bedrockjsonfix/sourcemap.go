@@ -0,0 +1,217 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SourceMap relates JSON values in Result.Output to the original input.
+//
+// Offsets survive CP1252 decoding, comment stripping, junk dropping, root
+// trimming and re-indentation because every cleanup pass records how it moved
+// bytes, and the re-encoded output is joined to the cleaned input by JSON
+// pointer.
+type SourceMap struct {
+	// Mappings holds one entry per JSON value in the output, ordered by output offset.
+	Mappings []Mapping
+
+	input []byte
+}
+
+// Mapping links a JSON value in the output to where it starts in the input.
+type Mapping struct {
+	// Pointer is the RFC 6901 JSON pointer of the value ("" for the root).
+	Pointer string
+	// Output is the byte offset of the value in Result.Output.
+	Output int
+	// Input is the byte offset of the value in the original input.
+	Input int
+}
+
+// Lookup returns the mapping of the value addressed by a JSON pointer.
+func (m *SourceMap) Lookup(pointer string) (Mapping, bool) {
+	if m == nil {
+		return Mapping{}, false
+	}
+	for _, e := range m.Mappings {
+		if e.Pointer == pointer {
+			return e, true
+		}
+	}
+	return Mapping{}, false
+}
+
+// InputOffset returns the input offset of the innermost value that starts at
+// or before outputOffset.
+func (m *SourceMap) InputOffset(outputOffset int) (int, bool) {
+	if m == nil || len(m.Mappings) == 0 || outputOffset < 0 {
+		return 0, false
+	}
+	i := sort.Search(len(m.Mappings), func(i int) bool { return m.Mappings[i].Output > outputOffset })
+	if i == 0 {
+		return 0, false
+	}
+	return m.Mappings[i-1].Input, true
+}
+
+// InputPosition converts an output offset into a line/column in the original input.
+func (m *SourceMap) InputPosition(outputOffset int) (Position, bool) {
+	off, ok := m.InputOffset(outputOffset)
+	if !ok {
+		return Position{}, false
+	}
+	return positionAt(m.input, off), true
+}
+
+// buildSourceMap joins the value offsets of the final cleaned candidate with
+// the value offsets of the output. candidate must be the exact slice that was
+// parsed, and trace must map candidate offsets back to input.
+func buildSourceMap(input, candidate, output []byte, trace *offsetTrace) *SourceMap {
+	cleaned := make(map[string]int)
+	for _, v := range valueOffsets(candidate) {
+		cleaned[v.ptr] = v.off
+	}
+	values := valueOffsets(output)
+	sm := &SourceMap{input: input, Mappings: make([]Mapping, 0, len(values))}
+	for _, v := range values {
+		src, ok := cleaned[v.ptr]
+		if !ok {
+			continue
+		}
+		sm.Mappings = append(sm.Mappings, Mapping{Pointer: v.ptr, Output: v.off, Input: trace.origin(src)})
+	}
+	return sm
+}
+
+// valueOffset is the JSON pointer and start offset of a value.
+type valueOffset struct {
+	ptr string
+	off int
+}
+
+// walkFrame is an open container of valueOffsets.
+type walkFrame struct {
+	val    int // index of the container in the values
+	ptrLen int // length of its pointer
+	array  bool
+	n      int // members seen
+}
+
+// valueOffsets returns the JSON pointer and start offset of every value in
+// data, in document order. data must be a valid JSON document. Pointers are
+// built in one buffer without recursion, and a container's pointer is a
+// prefix of the one of its last member, so nesting depth costs no more than
+// the pointers of the leaves.
+func valueOffsets(data []byte) []valueOffset {
+	var (
+		values []valueOffset
+		stack  []walkFrame
+		buf    []byte // pointer of the current value
+		last   string // pointer of the last value finished
+		pos    int
+	)
+	skipSpace := func() {
+		for pos < len(data) && isSpace(data[pos]) {
+			pos++
+		}
+	}
+	skipString := func() {
+		for pos++; pos < len(data); pos++ {
+			switch data[pos] {
+			case '\\':
+				pos++
+			case '"':
+				pos++
+				return
+			}
+		}
+	}
+	// finish sets the pointer of values[i], the first n bytes of buf.
+	finish := func(i, n int, members bool) {
+		if members {
+			last = last[:n]
+		} else {
+			last = string(buf[:n])
+		}
+		values[i].ptr = last
+	}
+	for {
+		skipSpace()
+		if pos >= len(data) {
+			break
+		}
+		i := len(values)
+		values = append(values, valueOffset{off: pos})
+		switch data[pos] {
+		case '{', '[':
+			stack = append(stack, walkFrame{val: i, ptrLen: len(buf), array: data[pos] == '['})
+			pos++
+		case '"':
+			skipString()
+			finish(i, len(buf), false)
+		default:
+			for pos < len(data) && !isSpace(data[pos]) && data[pos] != ',' && data[pos] != '}' && data[pos] != ']' {
+				pos++
+			}
+			finish(i, len(buf), false)
+		}
+		// Close containers up to the start of the next value.
+		for len(stack) > 0 {
+			skipSpace()
+			top := &stack[len(stack)-1]
+			if pos >= len(data) || data[pos] == '}' || data[pos] == ']' {
+				pos++
+				finish(top.val, top.ptrLen, top.n > 0)
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			if data[pos] == ',' {
+				pos++
+				continue
+			}
+			buf = append(buf[:top.ptrLen], '/')
+			if top.array {
+				buf = strconv.AppendInt(buf, int64(top.n), 10)
+			} else {
+				keyStart := pos
+				skipString()
+				buf = append(buf, escapePointerToken(unquoteKey(data[keyStart:pos]))...)
+				skipSpace()
+				pos++ // ':'
+			}
+			top.n++
+			break
+		}
+		if len(stack) == 0 {
+			break
+		}
+	}
+	return values
+}
+
+func unquoteKey(raw []byte) string {
+	if len(raw) < 2 {
+		return ""
+	}
+	inner := raw[1 : len(raw)-1]
+	if bytes.IndexByte(inner, '\\') < 0 {
+		return string(inner)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return string(inner)
+	}
+	return s
+}
+
+var pointerTokenEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapePointerToken(s string) string {
+	if !strings.ContainsAny(s, "~/") {
+		return s
+	}
+	return pointerTokenEscaper.Replace(s)
+}
@@ -0,0 +1,107 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSourceMapTracesValuesThroughCleanup(t *testing.T) {
+	opt := DefaultOptions()
+	opt.BuildSourceMap = true
+	in := []byte("\xEF\xBB\xBFjunk // header\n{\"name\": \"caf\xE9\", /* note */\n  \"list\": [1,\r\n    true,],\n}")
+	res, err := FixBytes(in, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SourceMap == nil {
+		t.Fatal("expected source map")
+	}
+	for _, tc := range []struct {
+		ptr  string
+		want string
+	}{
+		{"", "{\"name\""},
+		{"/name", "\"caf"},
+		{"/list", "[1,"},
+		{"/list/1", "true,]"},
+	} {
+		m, ok := res.SourceMap.Lookup(tc.ptr)
+		if !ok {
+			t.Fatalf("missing mapping for %q", tc.ptr)
+		}
+		if !bytes.HasPrefix(in[m.Input:], []byte(tc.want)) {
+			t.Fatalf("%q mapped to input %d (%q), want prefix %q", tc.ptr, m.Input, in[m.Input:], tc.want)
+		}
+	}
+}
+
+func TestSourceMapInputPosition(t *testing.T) {
+	opt := DefaultOptions()
+	opt.BuildSourceMap = true
+	in := []byte("{\n  // c\n  \"a\": 1,\n  \"b\": {\"c\": false,},\n}")
+	res, err := FixBytes(in, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outOff := bytes.Index(res.Output, []byte("false"))
+	pos, ok := res.SourceMap.InputPosition(outOff + 2)
+	if !ok {
+		t.Fatal("expected position")
+	}
+	if pos.Line != 4 || pos.Column != 14 {
+		t.Fatalf("expected line 4 column 14, got %+v", pos)
+	}
+}
+
+func TestSourceMapPreserveIfValidIsIdentity(t *testing.T) {
+	opt := DefaultOptions()
+	opt.BuildSourceMap = true
+	in := []byte(`{"a":[1,2]}`)
+	res, err := FixBytes(in, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range res.SourceMap.Mappings {
+		if m.Input != m.Output {
+			t.Fatalf("expected identity mapping, got %+v", m)
+		}
+	}
+}
+
+func TestSourceMapDisabledByDefault(t *testing.T) {
+	res, err := FixBytes([]byte(`{"a":1,}`), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SourceMap != nil {
+		t.Fatal("expected no source map without BuildSourceMap")
+	}
+}
+
+func TestSourceMapDeepNesting(t *testing.T) {
+	const depth = 9999
+	opt := DefaultOptions()
+	opt.BuildSourceMap = true
+	opt.Pretty = false
+	opt.PreserveIfValid = false
+	in := []byte(strings.Repeat("[", depth) + "1" + strings.Repeat("]", depth))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	res, err := FixBytes(in, opt)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(res.SourceMap.Mappings); n != depth+1 {
+		t.Fatalf("got %d mappings, want %d", n, depth+1)
+	}
+	if m, ok := res.SourceMap.Lookup(strings.Repeat("/0", depth)); !ok || m.Input != depth {
+		t.Fatalf("innermost value mapped to %+v, %v", m, ok)
+	}
+	// Spelled out one by one, the pointers would take about depth² bytes.
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 8<<20 {
+		t.Fatalf("allocated %d bytes", alloc)
+	}
+}
@@ -0,0 +1,219 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Stage is a custom rewriting step of the FixBytes pipeline, registered in
+// Options.Stages relative to a built-in stage.
+type Stage interface {
+	// Name identifies the stage in Report.Stages and in errors.
+	Name() string
+	// Apply returns buf rewritten and the number of changes it made, which
+	// is added to the stage's counter in Report.Stages. buf may alias the
+	// caller's input and must not be modified in place; return buf itself
+	// when nothing changes. rep is the report so far and may be updated.
+	// An error stops the pipeline with ErrStageFailed.
+	Apply(buf []byte, rep *Report) (out []byte, changes int, err error)
+}
+
+// Anchors inside the cleanup stage. Cleanup first sanitizes the input (BOM,
+// line endings, invisible and control characters, string escapes), then
+// strips comments, trailing commas and junk. A stage placed after
+// StageSanitize or before StageStripComments runs between the two, which
+// makes cleanup take two passes.
+const (
+	StageSanitize      = "sanitize"
+	StageStripComments = "strip_comments"
+)
+
+// StageAt places a Stage before or after a built-in stage. Exactly one of
+// Before and After is set, to StageDecode, StageCleanup, StageSanitize or
+// StageStripComments. Stages at the same place run in registration order;
+// the After stages of one built-in stage run before the Before stages of
+// the next. Before StageSanitize is the same place as Before StageCleanup,
+// and After StageStripComments the same as After StageCleanup.
+type StageAt struct {
+	Stage  Stage
+	Before string
+	After  string
+}
+
+// StageCount is the counter of one custom stage in Report.Stages.
+type StageCount struct {
+	Name    string
+	Changes int
+}
+
+// stageFunc adapts a function to Stage.
+type stageFunc struct {
+	name  string
+	apply func(buf []byte, rep *Report) ([]byte, int, error)
+}
+
+func (s stageFunc) Name() string { return s.name }
+func (s stageFunc) Apply(buf []byte, rep *Report) ([]byte, int, error) {
+	return s.apply(buf, rep)
+}
+
+// StageFunc returns a Stage named name that calls apply.
+func StageFunc(name string, apply func(buf []byte, rep *Report) ([]byte, int, error)) Stage {
+	return stageFunc{name: name, apply: apply}
+}
+
+func validateStages(stages []StageAt) error {
+	for i, at := range stages {
+		if at.Stage == nil || at.Stage.Name() == "" {
+			return &FixError{Code: "invalid_options", Message: fmt.Sprintf("stage %d has no stage or name", i), Cause: ErrOptionsInvalid}
+		}
+		if (at.Before == "") == (at.After == "") {
+			return &FixError{Code: "invalid_options", Message: fmt.Sprintf("stage %q must set exactly one of Before and After", at.Stage.Name()), Cause: ErrOptionsInvalid}
+		}
+		if stageSlot(at) < 0 {
+			return &FixError{Code: "invalid_options", Message: fmt.Sprintf("stage %q is placed at unknown stage %q", at.Stage.Name(), at.Before+at.After), Cause: ErrOptionsInvalid}
+		}
+	}
+	return nil
+}
+
+// Places between built-in stages, in pipeline order.
+const (
+	slotBeforeDecode = iota
+	slotAfterDecode
+	slotBeforeCleanup
+	slotAfterSanitize
+	slotBeforeStrip
+	slotAfterCleanup
+)
+
+// stageSlot returns the place of at, or -1 for an unknown anchor.
+func stageSlot(at StageAt) int {
+	switch {
+	case at.Before == StageDecode:
+		return slotBeforeDecode
+	case at.After == StageDecode:
+		return slotAfterDecode
+	case at.Before == StageCleanup || at.Before == StageSanitize:
+		return slotBeforeCleanup
+	case at.After == StageSanitize:
+		return slotAfterSanitize
+	case at.Before == StageStripComments:
+		return slotBeforeStrip
+	case at.After == StageCleanup || at.After == StageStripComments:
+		return slotAfterCleanup
+	}
+	return -1
+}
+
+// runStages applies the custom stages placed at the slots from through to,
+// in slot order. Each stage that changes buf adds a pass to trace that maps
+// the unchanged prefix and suffix exactly.
+func runStages(buf []byte, opt Options, from, to int, rep *Report, trace *offsetTrace) ([]byte, error) {
+	if len(opt.Stages) == 0 {
+		return buf, nil
+	}
+	// Stages see a copy so that handing it to them does not move the
+	// caller's Report to the heap on every run.
+	staged := *rep
+	defer func() { *rep = staged }()
+	for slot := from; slot <= to; slot++ {
+		for _, at := range opt.Stages {
+			if stageSlot(at) != slot {
+				continue
+			}
+			name := at.Stage.Name()
+			out, changes, err := at.Stage.Apply(buf, &staged)
+			if err != nil {
+				return nil, &FixError{Code: "stage_failed", Message: name + ": " + err.Error(), Cause: errors.Join(ErrStageFailed, err), Stage: name}
+			}
+			addStageCount(&staged, name, changes)
+			if !sameBytes(out, buf) {
+				markRewrite(trace.pass(), buf, out)
+			}
+			buf = out
+		}
+	}
+	return buf, nil
+}
+
+func addStageCount(rep *Report, name string, changes int) {
+	l := rep.editLists()
+	for i := range l.stages {
+		if l.stages[i].Name == name {
+			l.stages[i].Changes += changes
+			return
+		}
+	}
+	l.stages = append(l.stages, StageCount{Name: name, Changes: changes})
+}
+
+// sameBytes reports whether a and b are the same slice.
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// markRewrite records how dst was rewritten from src when only the span
+// between their common prefix and common suffix is known to differ.
+func markRewrite(m *offsetMap, src, dst []byte) {
+	n := min(len(src), len(dst))
+	prefix := 0
+	for prefix < n && src[prefix] == dst[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && src[len(src)-1-suffix] == dst[len(dst)-1-suffix] {
+		suffix++
+	}
+	m.mark(len(dst)-suffix, len(src)-suffix)
+}
+
+// hasStages reports whether a stage is placed at a slot from from through to.
+func hasStages(opt Options, from, to int) bool {
+	for _, at := range opt.Stages {
+		if slot := stageSlot(at); slot >= from && slot <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// locateRoot finds the span of the first balanced root value the way
+// cleanup does, for a buffer a stage rewrote after cleanup. end is -1 when
+// the root is not closed or its brackets do not match.
+func locateRoot(in []byte) (start, end int, kind RootKind) {
+	start, end, kind = -1, -1, RootUnknown
+	var stack []byte
+	lx := newTolerantLexer(in, 0, true)
+	for t := lx.next(); t.kind != tokEOF; t = lx.next() {
+		if t.kind != tokPunct {
+			continue
+		}
+		switch b := in[t.start]; b {
+		case '{', '[':
+			if start < 0 {
+				start, kind = t.start, RootArray
+				if b == '{' {
+					kind = RootObject
+				}
+			}
+			stack = append(stack, b)
+		case '}', ']':
+			if start < 0 {
+				continue
+			}
+			open := byte('{')
+			if b == ']' {
+				open = '['
+			}
+			if stack[len(stack)-1] != open {
+				return start, -1, kind
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return start, t.end, kind
+			}
+		}
+	}
+	return start, end, kind
+}
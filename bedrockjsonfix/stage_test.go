@@ -0,0 +1,164 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var stripMessagePrefix = StageFunc("strip-message", func(buf []byte, _ *Report) ([]byte, int, error) {
+	if rest, ok := bytes.CutPrefix(buf, []byte("Message: ")); ok {
+		return rest, 1, nil
+	}
+	return buf, 0, nil
+})
+
+func TestStageBeforeDecode(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty = false
+	opt.Stages = []StageAt{{Stage: stripMessagePrefix, Before: StageDecode}}
+	res, err := FixString(`Message: {"a": [1, 2,]}`, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Output) != "{\"a\":[1,2]}\n" {
+		t.Fatalf("unexpected output %q", res.Output)
+	}
+	if want := []StageCount{{Name: "strip-message", Changes: 1}}; !reflect.DeepEqual(res.Report.Stages(), want) {
+		t.Fatalf("stage counts %+v, want %+v", res.Report.Stages(), want)
+	}
+	if res.Report.TrimmedLeadingJunkBytes != 0 {
+		t.Fatalf("expected the stage to remove the prefix, got %+v", res.Report)
+	}
+
+	// Error positions still point into the original input.
+	_, err = FixString("Message: {\"a\": 1 \"b\": 2}", opt)
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Column != 18 {
+		t.Fatalf("expected error at column 18, got %v", err)
+	}
+}
+
+func TestStagesRunInPlacementOrder(t *testing.T) {
+	var order []string
+	record := func(name string) Stage {
+		return StageFunc(name, func(buf []byte, _ *Report) ([]byte, int, error) {
+			order = append(order, name)
+			return buf, 0, nil
+		})
+	}
+	opt := DefaultOptions()
+	opt.Stages = []StageAt{
+		{Stage: record("after-cleanup"), After: StageCleanup},
+		{Stage: record("before-cleanup-1"), Before: StageCleanup},
+		{Stage: record("after-decode"), After: StageDecode},
+		{Stage: record("before-decode"), Before: StageDecode},
+		{Stage: record("before-cleanup-2"), Before: StageCleanup},
+		{Stage: record("before-strip"), Before: StageStripComments},
+		{Stage: record("after-sanitize"), After: StageSanitize},
+		{Stage: record("before-sanitize"), Before: StageSanitize},
+		{Stage: record("after-strip"), After: StageStripComments},
+	}
+	res, err := FixString(`{"a":1}`, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"before-decode", "after-decode", "before-cleanup-1", "before-cleanup-2", "before-sanitize",
+		"after-sanitize", "before-strip", "after-cleanup", "after-strip"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("stages ran in order %v, want %v", order, want)
+	}
+	if len(res.Report.Stages()) != len(want) || res.Report.Stages()[0].Name != "before-decode" {
+		t.Fatalf("unexpected stage counts %+v", res.Report.Stages())
+	}
+}
+
+func TestStageAfterCleanupSeesCleanedBuffer(t *testing.T) {
+	unwrap := StageFunc("unwrap-envelope", func(buf []byte, rep *Report) ([]byte, int, error) {
+		if bytes.Contains(buf, []byte("//")) || rep.StrippedLineComments != 1 {
+			return nil, 0, errors.New("cleanup did not run first")
+		}
+		inner, ok := bytes.CutPrefix(buf, []byte(`ENVELOPE `))
+		if !ok {
+			return buf, 0, nil
+		}
+		return append([]byte("["), append(inner, ']')...), 1, nil
+	})
+	opt := DefaultOptions()
+	opt.Pretty = false
+	opt.Stages = []StageAt{{Stage: unwrap, After: StageCleanup}}
+	res, err := FixString("ENVELOPE {\"a\": 1} // sent by bot\n", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Output) != "[{\"a\":1}]\n" || res.Root != RootArray {
+		t.Fatalf("unexpected output %q root %v", res.Output, res.Root)
+	}
+}
+
+func TestStageBetweenSanitizeAndStripComments(t *testing.T) {
+	// The bot prefixes each line with "Message: " and its comments may
+	// contain CRLF; the stage sees sanitized bytes with comments intact.
+	var seen string
+	unprefix := StageFunc("unprefix", func(buf []byte, rep *Report) ([]byte, int, error) {
+		seen = string(buf)
+		n := bytes.Count(buf, []byte("Message: "))
+		return bytes.ReplaceAll(buf, []byte("Message: "), nil), n, nil
+	})
+	opt := DefaultOptions()
+	opt.Pretty = false
+	opt.Stages = []StageAt{{Stage: unprefix, After: StageSanitize}}
+	in := "\xEF\xBB\xBFMessage: {\"a\": 1, // note\r\nMessage: \"b\": 2,}\r\n"
+	res, err := FixString(in, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != "Message: {\"a\": 1, // note\nMessage: \"b\": 2,}\n" {
+		t.Fatalf("stage saw %q", seen)
+	}
+	if string(res.Output) != `{"a":1,"b":2}`+"\n" {
+		t.Fatalf("unexpected output %q", res.Output)
+	}
+	if rep := res.Report; rep.RemovedBOM != 1 || rep.StrippedLineComments != 1 || rep.RemovedTrailingCommas != 1 || rep.Stages()[0].Changes != 2 {
+		t.Fatalf("unexpected report %+v %+v", rep, rep.Stages())
+	}
+
+	_, err = FixString("Message: {\"a\": 1 \"b\": 2}", opt)
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Column != 18 {
+		t.Fatalf("expected error at column 18, got %v", err)
+	}
+}
+
+func TestStageErrorStopsPipeline(t *testing.T) {
+	boom := errors.New("bad envelope")
+	opt := DefaultOptions()
+	opt.Stages = []StageAt{{Stage: StageFunc("envelope", func([]byte, *Report) ([]byte, int, error) { return nil, 0, boom }), Before: StageCleanup}}
+	_, err := FixString(`{}`, opt)
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Code != "stage_failed" || fe.Stage != "envelope" || !errors.Is(err, ErrStageFailed) || !errors.Is(err, boom) {
+		t.Fatalf("expected stage_failed for envelope, got %v", err)
+	}
+}
+
+func TestStagesValidateAndStreamRejects(t *testing.T) {
+	for _, at := range []StageAt{
+		{Stage: stripMessagePrefix},
+		{Stage: stripMessagePrefix, Before: StageDecode, After: StageDecode},
+		{Stage: stripMessagePrefix, Before: StageParse},
+		{Before: StageDecode},
+	} {
+		opt := DefaultOptions()
+		opt.Stages = []StageAt{at}
+		if err := opt.Validate(); !errors.Is(err, ErrOptionsInvalid) {
+			t.Fatalf("expected ErrOptionsInvalid for %+v, got %v", at, err)
+		}
+	}
+
+	opt := DefaultStreamOptions()
+	opt.Stages = []StageAt{{Stage: stripMessagePrefix, Before: StageDecode}}
+	if _, _, err := streamString(t, `{}`, opt); !errors.Is(err, ErrStreamUnsupported) {
+		t.Fatalf("expected ErrStreamUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,507 @@
+package bedrockjsonfix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultStreamWindowBytes = 1 << 20
+	minStreamWindowBytes     = 64
+	streamFlushBytes         = 32 << 10
+)
+
+// DefaultStreamOptions returns DefaultOptions without the features FixStream
+// cannot provide: PreserveIfValid, root scanning and the CP1252 fallback.
+func DefaultStreamOptions() Options {
+	opt := DefaultOptions()
+	opt.PreserveIfValid = false
+	opt.RootPolicy = RootPolicyFirst
+	opt.AllowCP1252Fallback = false
+	return opt
+}
+
+// streamUnsupported rejects options that need the whole document in memory.
+func streamUnsupported(opt Options) error {
+	fixes := opt.effectiveFixes()
+	var used []string
+	if opt.PreserveIfValid {
+		used = append(used, "PreserveIfValid")
+	}
+	if fixes&RepairRootScan != 0 {
+		used = append(used, "root scanning")
+	}
+	if fixes&RepairCP1252 != 0 {
+		used = append(used, "CP1252 fallback")
+	}
+	if opt.RootValidator != nil {
+		used = append(used, "RootValidator")
+	}
+	if opt.BuildSourceMap {
+		used = append(used, "BuildSourceMap")
+	}
+	if len(opt.Stages) > 0 {
+		used = append(used, "Stages")
+	}
+	if opt.Output == OutputJSONC {
+		used = append(used, "OutputJSONC")
+	}
+	if opt.UnwrapMarkdown {
+		used = append(used, "UnwrapMarkdown")
+	}
+	if opt.UnwrapStringEncodedJSON {
+		used = append(used, "UnwrapStringEncodedJSON")
+	}
+	if opt.DecodeTransport {
+		used = append(used, "DecodeTransport")
+	}
+	if len(used) == 0 {
+		return nil
+	}
+	return &FixError{Code: "stream_unsupported", Message: strings.Join(used, ", ") + " needs the whole document and cannot be used with FixStream", Cause: ErrStreamUnsupported}
+}
+
+// FixStream normalizes tolerant JSON-ish input from r and writes strict JSON
+// to w while reading. Memory is bounded by the nesting depth and
+// Options.StreamWindowBytes, which every single token (such as a long
+// string) must fit in.
+//
+// Output already written to w is not retracted when a later error occurs. The returned
+// Result has no Output. Options that need the whole document
+// (PreserveIfValid, root scanning, CP1252 fallback, RootValidator,
+// BuildSourceMap) return ErrStreamUnsupported; see DefaultStreamOptions.
+func FixStream(ctx context.Context, r io.Reader, w io.Writer, opt Options) (Result, error) {
+	if err := opt.Validate(); err != nil {
+		return Result{}, err
+	}
+	if err := streamUnsupported(opt); err != nil {
+		return Result{}, err
+	}
+	window := opt.StreamWindowBytes
+	if window == 0 {
+		window = defaultStreamWindowBytes
+	}
+	fixes := opt.effectiveFixes()
+	s := &streamFixer{
+		ctx:   ctx,
+		r:     r,
+		w:     w,
+		opt:   opt,
+		fixes: fixes,
+		em:    newEmitter(opt),
+		buf:   make([]byte, window),
+		at:    Position{Line: 1, Column: 1},
+	}
+	s.em.out = make([]byte, 0, streamFlushBytes+streamFlushBytes/2)
+	if fixes&RepairLeadingJunk != 0 {
+		s.phase = phaseLeading
+	} else {
+		s.phase = phaseBody
+		s.dropping = fixes&RepairDropJunk != 0
+	}
+	if err := s.run(); err != nil {
+		return Result{}, err
+	}
+	res := Result{Root: s.em.root, Report: s.rep, Warnings: warningsFromReport(s.rep)}
+	return res, nil
+}
+
+// streamPhase is where FixStream is relative to the root value.
+type streamPhase int
+
+const (
+	phaseLeading streamPhase = iota
+	phaseBody
+	phaseTrailing
+)
+
+type streamFixer struct {
+	ctx   context.Context
+	r     io.Reader
+	w     io.Writer
+	opt   Options
+	fixes Repair
+	rep   Report
+	junk  junkTally
+	em    emitter
+
+	// buf[pos:n] is the unread window. at is the input position of buf[0].
+	buf  []byte
+	pos  int
+	n    int
+	eof  bool
+	read int64
+	at   Position
+
+	strBuf   []byte
+	written  int64
+	phase    streamPhase
+	dropping bool
+
+	// comma is set while a comma at window offset commaOff waits for the
+	// next significant token, which decides whether it is a trailing comma
+	// as in cleanup. The window keeps it until then.
+	comma    bool
+	commaOff int
+}
+
+func (s *streamFixer) run() error {
+	select {
+	case <-s.ctx.Done():
+		return contextCanceledError()
+	default:
+	}
+	for s.n < 3 && !s.eof {
+		if err := s.fill(); err != nil {
+			return err
+		}
+	}
+	if s.fixes&RepairBOM != 0 && s.n >= 3 && s.buf[0] == 0xEF && s.buf[1] == 0xBB && s.buf[2] == 0xBF {
+		s.rep.RemovedBOM++
+		s.pos = 3
+	}
+	for {
+		t, err := s.next()
+		if err != nil {
+			return err
+		}
+		if t.kind == tokEOF {
+			break
+		}
+		if err := s.token(t); err != nil {
+			return err
+		}
+		s.pos = t.end
+		if len(s.em.out) >= streamFlushBytes {
+			if err := s.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if s.phase == phaseLeading {
+		pos, snippet := s.locate(s.n)
+		return &FixError{Code: "no_root", Message: "no JSON root object/array found", Cause: ErrNoRootFound, Position: pos, Snippet: snippet, Stage: StageTrimToFirstRoot}
+	}
+	if err := s.em.finish(); err != nil {
+		return s.syntaxError(s.n, err)
+	}
+	s.rep.ValidJSON = true
+	return s.flush()
+}
+
+// next lexes the next token, refilling the window until the token is known
+// to be complete.
+func (s *streamFixer) next() (lexToken, error) {
+	for {
+		lx := newTolerantLexer(s.buf[:s.n], s.pos, s.fixes&(RepairLineComments|RepairBlockComments) != 0)
+		t := lx.next()
+		if s.eof || (t.kind != tokEOF && t.end < s.n) {
+			return t, nil
+		}
+		if err := s.fill(); err != nil {
+			return lexToken{}, err
+		}
+	}
+}
+
+func (s *streamFixer) fill() error {
+	if shift := s.pos; shift > 0 {
+		if s.comma {
+			shift = min(shift, s.commaOff)
+			s.commaOff -= shift
+		}
+		s.at = advancePosition(s.at, s.buf[:shift])
+		s.n = copy(s.buf, s.buf[shift:s.n])
+		s.pos -= shift
+	}
+	if s.n == len(s.buf) {
+		pos, _ := s.locate(0)
+		return &FixError{Code: "stream_window_exceeded", Message: fmt.Sprintf("line %d, column %d: token exceeds stream window of %d bytes", pos.Line, pos.Column, len(s.buf)), Cause: ErrTokenTooLarge, Position: pos, Stage: StageParse}
+	}
+	if s.ctx.Err() != nil {
+		return contextCanceledError()
+	}
+	n, err := s.r.Read(s.buf[s.n:])
+	if n > 0 {
+		s.read += int64(n)
+		if s.read > s.opt.MaxInputBytes {
+			return inputTooLargeError(s.read, s.opt.MaxInputBytes)
+		}
+		s.n += n
+	}
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			if s.ctx.Err() != nil {
+				return contextCanceledError()
+			}
+			return err
+		}
+		s.eof = true
+	}
+	return nil
+}
+
+func (s *streamFixer) flush() error {
+	if s.phase != phaseLeading {
+		classifyRepairs(&s.rep, s.junk)
+		if err := checkRisk(s.rep, s.junk, s.opt); err != nil {
+			return err
+		}
+	}
+	if s.written+int64(len(s.em.out)) > s.opt.MaxOutputBytes {
+		return &FixError{Code: "output_too_large", Message: fmt.Sprintf("output exceeds limit (%d > %d)", s.written+int64(len(s.em.out)), s.opt.MaxOutputBytes), Cause: ErrOutputTooLarge}
+	}
+	if len(s.em.out) == 0 {
+		return nil
+	}
+	if _, err := s.w.Write(s.em.out); err != nil {
+		return err
+	}
+	s.written += int64(len(s.em.out))
+	s.em.out = s.em.out[:0]
+	return nil
+}
+
+func (s *streamFixer) token(t lexToken) error {
+	raw := s.buf[t.start:t.end]
+	if t.kind == tokString || t.kind == tokJunk || t.kind == tokLineComment || t.kind == tokBlockComment {
+		if !utf8.Valid(raw) {
+			off := t.start + firstInvalidUTF8(raw)
+			pos, snippet := s.locate(off)
+			return &FixError{Code: "invalid_encoding", Message: "input must be valid UTF-8", Cause: ErrInvalidJSON, Position: pos, Snippet: snippet, Reason: "invalid UTF-8 sequence", Stage: StageDecode}
+		}
+	}
+	switch s.phase {
+	case phaseLeading:
+		if t.kind == tokPunct && (raw[0] == '{' || raw[0] == '[') {
+			s.phase = phaseBody
+			s.dropping = s.fixes&RepairDropJunk != 0
+			return s.body(t, raw)
+		}
+		n := s.trivia(t, raw)
+		s.rep.TrimmedLeadingJunkBytes += n
+		s.junk.leading += nonSpaceBytes(raw[:n])
+		return checkDroppedJunk(s.rep, s.junk, s.opt)
+	case phaseTrailing:
+		if t.kind == tokJunk && s.dropping {
+			return s.body(t, raw)
+		}
+		if s.fixes&RepairTrailingJunk != 0 {
+			n := s.trivia(t, raw)
+			s.rep.TrimmedTrailingJunkBytes += n
+			s.junk.trailing += nonSpaceBytes(raw[:n])
+			return checkDroppedJunk(s.rep, s.junk, s.opt)
+		}
+		switch t.kind {
+		case tokWhitespace, tokLineComment, tokBlockComment:
+			return s.body(t, raw)
+		}
+		return s.syntaxError(t.start, s.em.unexpected(raw[0]))
+	}
+	return s.body(t, raw)
+}
+
+// trivia counts the repairs applied to a token that is trimmed rather than
+// emitted and returns the number of bytes trimmed as junk. Whitespace is
+// not junk.
+func (s *streamFixer) trivia(t lexToken, raw []byte) int {
+	switch t.kind {
+	case tokWhitespace:
+		return 0
+	case tokLineComment:
+		if s.fixes&RepairLineComments != 0 {
+			s.rep.StrippedLineComments++
+			return 0
+		}
+	case tokBlockComment:
+		if s.fixes&RepairBlockComments != 0 {
+			s.rep.StrippedBlockComments++
+			return 0
+		}
+	}
+	return len(raw)
+}
+
+func (s *streamFixer) body(t lexToken, raw []byte) error {
+	if s.comma && !commaTrivia(t, s.fixes) {
+		s.comma = false
+		if t.kind == tokPunct && (raw[0] == '}' || raw[0] == ']') {
+			s.rep.RemovedTrailingCommas++
+		} else if err := s.em.comma(); err != nil {
+			return s.syntaxError(s.commaOff, err)
+		}
+	}
+	var err error
+	switch t.kind {
+	case tokWhitespace:
+		if t.flags != 0 {
+			return s.whitespace(t)
+		}
+		return nil
+	case tokLineComment:
+		if s.fixes&RepairLineComments == 0 {
+			return s.disallowed(t.start, RepairLineComments, "line comment")
+		}
+		s.rep.StrippedLineComments++
+		return nil
+	case tokBlockComment:
+		if s.fixes&RepairBlockComments == 0 {
+			return s.disallowed(t.start, RepairBlockComments, "block comment")
+		}
+		s.rep.StrippedBlockComments++
+		return nil
+	case tokString:
+		if t.flags&(flagNewline|flagControl|flagNBSP|flagZeroWidth) != 0 {
+			if raw, err = s.repairString(t); err != nil {
+				return err
+			}
+		}
+		err = s.em.str(raw)
+	case tokNumber:
+		err = s.em.number(raw)
+	case tokLiteral:
+		err = s.em.scalar(raw)
+	case tokPunct:
+		switch raw[0] {
+		case '{', '[':
+			err = s.em.open(raw[0])
+		case '}', ']':
+			err = s.em.close(raw[0])
+		case ':':
+			err = s.em.colon()
+		case ',':
+			if s.fixes&RepairTrailingCommas != 0 {
+				s.comma, s.commaOff = true, t.start
+				return nil
+			}
+			err = s.em.comma()
+		}
+	case tokJunk:
+		if !s.dropping {
+			return s.syntaxError(t.start, s.em.unexpected(raw[0]))
+		}
+		s.rep.DroppedJunkOutsideStrings += len(raw)
+		return checkDroppedJunk(s.rep, s.junk, s.opt)
+	}
+	if err != nil {
+		return s.syntaxError(t.start, err)
+	}
+	if s.em.done() {
+		s.phase = phaseTrailing
+	}
+	return nil
+}
+
+// whitespace counts the repairs in a whitespace token and rejects characters
+// whose repair is disabled. CR is JSON whitespace and needs no repair.
+func (s *streamFixer) whitespace(t lexToken) error {
+	in := s.buf[:t.end]
+	for i := t.start; i < t.end; {
+		b := in[i]
+		switch {
+		case b == '\r':
+			if s.fixes&RepairCRLF != 0 {
+				s.rep.NormalizedCRLF++
+				if i+1 < t.end && in[i+1] == '\n' {
+					i++
+				}
+			}
+		case b < 0x20 && b != '\n' && b != '\t':
+			if s.fixes&RepairASCIIControls == 0 {
+				return s.disallowed(i, RepairASCIIControls, "control character")
+			}
+			s.rep.RemovedASCIIControls++
+		case b == 0xC2:
+			if s.fixes&RepairNBSP == 0 {
+				return s.disallowed(i, RepairNBSP, "non-breaking space")
+			}
+			s.rep.ReplacedNBSP++
+		case b == 0xE2:
+			if s.fixes&RepairZeroWidth == 0 {
+				return s.disallowed(i, RepairZeroWidth, "zero-width character")
+			}
+			s.rep.RemovedZeroWidth++
+		}
+		i += whitespaceWidth(b)
+	}
+	return nil
+}
+
+// repairString applies the enabled string repairs to a string token and
+// returns the repaired lexeme. Disabled repairs are reported as errors.
+func (s *streamFixer) repairString(t lexToken) ([]byte, error) {
+	in := s.buf[:t.end]
+	out := s.strBuf[:0]
+	defer func() { s.strBuf = out[:0] }()
+	esc := false
+	for i := t.start; i < t.end; i++ {
+		b := in[i]
+		if esc {
+			esc = false
+			out = append(out, b)
+			continue
+		}
+		switch {
+		case b == '\\':
+			esc = true
+		case b == '\n':
+			if s.fixes&RepairStringNewlines == 0 {
+				return nil, s.disallowed(i, RepairStringNewlines, "literal newline in string")
+			}
+			s.rep.NormalizedNewlinesInStrings++
+			out = append(out, '\\', 'n')
+			continue
+		case b < 0x20:
+			if s.fixes&RepairStringControls == 0 {
+				return nil, s.disallowed(i, RepairStringControls, "control character in string")
+			}
+			s.rep.EscapedStringControls++
+			out = appendEscapedControl(out, b)
+			continue
+		case b == 0xC2 && i+1 < t.end && in[i+1] == 0xA0 && s.fixes&RepairStringWhitespace != 0:
+			s.rep.ReplacedNBSP++
+			s.rep.ReplacedNBSPInStrings++
+			out = append(out, ' ')
+			i++
+			continue
+		case b == 0xE2 && isZeroWidthAt(in, i) && s.fixes&RepairStringWhitespace != 0:
+			s.rep.RemovedZeroWidth++
+			s.rep.RemovedZeroWidthInStrings++
+			i += 2
+			continue
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// locate returns the input position and snippet of window offset off.
+func (s *streamFixer) locate(off int) (Position, string) {
+	// The snippet is cut from the window, so its caret uses window columns.
+	return advancePosition(s.at, s.buf[:off]), snippetAt(s.buf[:s.n], positionAt(s.buf[:s.n], off))
+}
+
+func (s *streamFixer) syntaxError(off int, cause error) error {
+	pos, snippet := s.locate(off)
+	if ee, ok := asLimitError(cause); ok {
+		return newLimitError(pos, snippet, ee)
+	}
+	return newInvalidJSONError(pos, snippet, cause.Error(), cause, StageParse, 0)
+}
+
+func (s *streamFixer) disallowed(off int, repair Repair, what string) error {
+	pos, snippet := s.locate(off)
+	return &FixError{
+		Code:     "repair_disallowed",
+		Message:  fmt.Sprintf("line %d, column %d: %s repair is disabled", pos.Line, pos.Column, repair),
+		Cause:    errors.Join(ErrRepairDisallowed, ErrInvalidJSON),
+		Position: pos,
+		Snippet:  snippet,
+		Reason:   what,
+		Stage:    StageParse,
+	}
+}
@@ -0,0 +1,224 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func streamString(t *testing.T, input string, opt Options) (string, Result, error) {
+	t.Helper()
+	var out bytes.Buffer
+	res, err := FixStream(t.Context(), iotest.OneByteReader(strings.NewReader(input)), &out, opt)
+	return out.String(), res, err
+}
+
+func TestFixStreamMatchesFixBytes(t *testing.T) {
+	inputs := []string{
+		"\xEF\xBB\xBF// header\r\n{\r\n  \"a\": 1, /* c */\r\n  \"b\": [1, 2.5e+3, true, null,],\r\n}\r\n",
+		"note: {\"a\":\"x\ty\", \"b\":\"l1\nl2\"} {\"next\": 1}",
+		`[{"a":"<&>\u00e9\ud83d\ude00\/","b":"\u2028 \ud800"}, -0, 1E-2, "", [], {}]`,
+		"{\"a\":\u00a0[1,\u200b2]}",
+		`{"a": 1 junk, "b": [2, x 3]}`,
+		strings.Repeat("[", 40) + strings.Repeat("]", 40),
+	}
+	for _, pretty := range []bool{true, false} {
+		for _, input := range inputs {
+			opt := DefaultStreamOptions()
+			opt.Pretty = pretty
+			opt.StreamWindowBytes = 64
+			want, err := FixBytes([]byte(input), opt)
+			if err != nil {
+				t.Fatalf("FixBytes(%q): %v", input, err)
+			}
+			got, res, err := streamString(t, input, opt)
+			if err != nil {
+				t.Fatalf("FixStream(%q): %v", input, err)
+			}
+			if got != string(want.Output) {
+				t.Fatalf("FixStream(%q) pretty=%v:\n%s\nwant\n%s", input, pretty, got, want.Output)
+			}
+			if res.Root != want.Root || res.Report.Repairs != want.Report.Repairs {
+				t.Fatalf("FixStream(%q): root %v repairs %v, want %v %v", input, res.Root, res.Report.Repairs, want.Root, want.Report.Repairs)
+			}
+		}
+	}
+}
+
+// streamCorpus holds inputs from the FixBytes tests, compared against
+// FixStream by TestFixStreamDifferential.
+var streamCorpus = []string{
+	"  \n{\"a\":1,}",
+	"// c\n{\"a\":1,}\n",
+	"\xEF\xBB\xBF{// c\n\"a\":1,}",
+	"garbage...{\"a\":1}",
+	"{// ok\n\"a\":1,\n}",
+	"{//x\n\"a\":1/*y*/}\n",
+	"{\"a\":1,}\n\n\n",
+	"{\"a\":1} trailing",
+	"{\"a\":\"x\u00a0y\"}",
+	"{{oops} {\"ok\":true}",
+	"{{x} {\"a\" 1}",
+	`" {"a":1}`,
+	`"x{y"  {"a":1}`,
+	`[1/*comment*/2]`,
+	`ab {"a":1}`,
+	`{"a": 1e+5, "b": 2E+3}`,
+	`{"a":1,"b":} {"ok":true}`,
+	`{"a":1} $$$`,
+	`{"a":1} {"b":2}`,
+	`{"a":1}"`,
+	`{"a":[1]}` + "\n// x",
+	`{"format_version":"1.20.0","minecraft:block":{"description":{},"components":{}},}`,
+	`{,}`,
+	`[,]`,
+	`[nulltrue,]`,
+	`["s",{},']`,
+	`[1,,2]`,
+	`{"a":1,,}`,
+	`[1, /* c */ ]`,
+	`[1 2]`,
+	`{"a" 1}`,
+	"[1,]\n\n",
+	"x [1] y",
+	"[1,\r\n]",
+	"no json",
+	"[1, 2",
+}
+
+func TestFixStreamDifferential(t *testing.T) {
+	for _, input := range streamCorpus {
+		opt := DefaultStreamOptions()
+		opt.StreamWindowBytes = 64
+		want, wantErr := FixBytes([]byte(input), opt)
+		got, res, err := streamString(t, input, opt)
+		var wantFE, gotFE *FixError
+		errors.As(wantErr, &wantFE)
+		errors.As(err, &gotFE)
+		if (wantErr == nil) != (err == nil) || (wantFE != nil && (gotFE == nil || gotFE.Code != wantFE.Code)) {
+			t.Fatalf("FixStream(%q) error = %v, want %v", input, err, wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if got != string(want.Output) || res.Root != want.Root || res.Report.Repairs != want.Report.Repairs {
+			t.Fatalf("FixStream(%q) = %q, root %v, repairs %v, want %q, %v, %v", input, got, res.Root, res.Report.Repairs, want.Output, want.Root, want.Report.Repairs)
+		}
+		if res.Report.DroppedJunkOutsideStrings != want.Report.DroppedJunkOutsideStrings || res.Report.RemovedTrailingCommas != want.Report.RemovedTrailingCommas {
+			t.Fatalf("FixStream(%q) report %+v, want %+v", input, res.Report, want.Report)
+		}
+	}
+}
+
+func TestFixStreamWhitespaceIsNotJunk(t *testing.T) {
+	_, res, err := streamString(t, "\n {\"a\":1} \n\n", DefaultStreamOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep := res.Report; rep.TrimmedLeadingJunkBytes != 0 || rep.TrimmedTrailingJunkBytes != 0 || rep.Repairs != 0 {
+		t.Fatalf("report %+v, want no junk for whitespace", rep)
+	}
+}
+
+func TestFixStreamKeepsMemberOrder(t *testing.T) {
+	opt := DefaultStreamOptions()
+	opt.Pretty = false
+	got, _, err := streamString(t, `{"z":1,"a":{"y":2,"b":3}}`, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "{\"z\":1,\"a\":{\"y\":2,\"b\":3}}\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
+
+func TestFixStreamRejectsWholeDocumentOptions(t *testing.T) {
+	_, _, err := streamString(t, `{}`, DefaultOptions())
+	if !errors.Is(err, ErrStreamUnsupported) {
+		t.Fatalf("expected ErrStreamUnsupported, got %v", err)
+	}
+	for _, name := range []string{"PreserveIfValid", "root scanning", "CP1252 fallback"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Fatalf("expected %q in %v", name, err)
+		}
+	}
+
+	opt := DefaultStreamOptions()
+	opt.BuildSourceMap = true
+	if _, _, err := streamString(t, `{}`, opt); !errors.Is(err, ErrStreamUnsupported) {
+		t.Fatalf("expected ErrStreamUnsupported for BuildSourceMap, got %v", err)
+	}
+}
+
+func TestFixStreamErrorPositionMatchesFixBytes(t *testing.T) {
+	input := "{\n  \"a\": 1,\n  \"b\": 2\n  \"c\": 3\n}"
+	opt := DefaultStreamOptions()
+	opt.StreamWindowBytes = 64
+	_, want := FixBytes([]byte(input), opt)
+	_, _, got := streamString(t, input, opt)
+	var wantErr, gotErr *FixError
+	if !errors.As(want, &wantErr) || !errors.As(got, &gotErr) {
+		t.Fatalf("expected FixErrors, got %v and %v", want, got)
+	}
+	if gotErr.Code != "invalid_json" || gotErr.Position != wantErr.Position || gotErr.Reason != wantErr.Reason {
+		t.Fatalf("stream error %+v, want %+v", gotErr, wantErr)
+	}
+	if !errors.Is(got, ErrInvalidJSON) {
+		t.Fatalf("expected ErrInvalidJSON, got %v", got)
+	}
+}
+
+func TestFixStreamTokenMustFitWindow(t *testing.T) {
+	opt := DefaultStreamOptions()
+	opt.StreamWindowBytes = 64
+	_, _, err := streamString(t, `{"a":"`+strings.Repeat("x", 100)+`"}`, opt)
+	if !errors.Is(err, ErrTokenTooLarge) {
+		t.Fatalf("expected ErrTokenTooLarge, got %v", err)
+	}
+}
+
+func TestFixStreamDisallowedRepair(t *testing.T) {
+	opt := DefaultStreamOptions()
+	opt.Fixes = RepairsBedrock &^ RepairLineComments
+	_, _, err := streamString(t, "{\"a\": 1 // note\n}", opt)
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Code != "repair_disallowed" || fe.Line != 1 || fe.Column != 9 {
+		t.Fatalf("expected repair_disallowed at 1:9, got %v", err)
+	}
+}
+
+func TestFixStreamLimits(t *testing.T) {
+	opt := DefaultStreamOptions()
+	opt.MaxInputBytes = 8
+	if _, _, err := streamString(t, `{"a":[1,2,3]}`, opt); !errors.Is(err, ErrInputTooLarge) {
+		t.Fatalf("expected ErrInputTooLarge, got %v", err)
+	}
+
+	opt = DefaultStreamOptions()
+	opt.MaxDroppedJunkBytes = 3
+	if _, _, err := streamString(t, `{"a": 1 junk}`, opt); !errors.Is(err, ErrRepairTooLossy) {
+		t.Fatalf("expected ErrRepairTooLossy, got %v", err)
+	}
+
+	opt = DefaultStreamOptions()
+	opt.Pretty = false
+	opt.MaxOutputBytes = 4
+	if _, _, err := streamString(t, `{"a":1}`, opt); !errors.Is(err, ErrOutputTooLarge) {
+		t.Fatalf("expected ErrOutputTooLarge, got %v", err)
+	}
+}
+
+func TestAppendJSONStringMatchesEncodingJSON(t *testing.T) {
+	for _, s := range []string{"", "plain", "<a href=\"x\">&</a>", "tab\tnl\ncr\r\b\f\x01\x1f", "\\", "é😀", "\u2028\u2029", "bad\xffutf8"} {
+		want, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := appendJSONString(nil, []byte(s)); string(got) != string(want) {
+			t.Fatalf("appendJSONString(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// unwrapStringJSON decodes a document sent as a JSON string for
+// Options.UnwrapStringEncodedJSON, as often as the input is a string whose
+// contents are another string or an object or array. A layer is only
+// unwrapped when the innermost contents are one balanced object or array
+// with nothing but whitespace around it, so prose that merely starts with
+// a bracket stays a string; the caller's pipeline repairs the inside of the
+// value. It returns the innermost
+// document and the number of layers removed, adding one pass per layer to
+// trace.
+func unwrapStringJSON(in []byte, trace *offsetTrace) ([]byte, int) {
+	base := trace.len()
+	layers, body := 0, in
+	for {
+		next, ok := decodeStringLayer(body, trace.pass())
+		if !ok {
+			trace.truncate(trace.len() - 1)
+			break
+		}
+		body = next
+		layers++
+		if isWholeRoot(body) {
+			return body, layers
+		}
+	}
+	// The contents of the innermost string are not a document.
+	trace.truncate(base)
+	return in, 0
+}
+
+// isWholeRoot reports whether b, but for surrounding whitespace, is one
+// balanced object or array.
+func isWholeRoot(b []byte) bool {
+	start, end, _ := locateRoot(b)
+	return start >= 0 && end >= 0 &&
+		len(bytes.TrimLeft(b[:start], " \t\r\n")) == 0 &&
+		len(bytes.TrimLeft(b[end:], " \t\r\n")) == 0
+}
+
+// decodeStringLayer returns the decoded contents of the JSON string that is
+// all of in but surrounding whitespace, recording in m where each decoded
+// byte came from. Raw control characters and unknown escapes are kept as
+// they are.
+func decodeStringLayer(in []byte, m *offsetMap) ([]byte, bool) {
+	start := len(in) - len(bytes.TrimLeft(in, " \t\r\n"))
+	if start == len(in) || in[start] != '"' {
+		return nil, false
+	}
+	lx := newTolerantLexer(in, start, false)
+	t := lx.next()
+	if t.flags&flagUnterminated != 0 || len(bytes.TrimLeft(in[t.end:], " \t\r\n")) != 0 {
+		return nil, false
+	}
+	body, off := in[t.start+1:t.end-1], t.start+1
+	out := make([]byte, 0, len(body))
+	m.mark(0, off)
+	for i := 0; i < len(body); {
+		c := body[i]
+		if c != '\\' || i+1 == len(body) {
+			out = append(out, c)
+			i++
+			continue
+		}
+		n := 2
+		switch e := body[i+1]; e {
+		case '"', '\\', '/':
+			out = append(out, e)
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, ok := hex4(body, i+2)
+			if !ok {
+				out = append(out, body[i:i+2]...)
+				break
+			}
+			n = 6
+			if utf16.IsSurrogate(r) {
+				r2, ok := rune(0), false
+				if i+7 < len(body) && body[i+6] == '\\' && body[i+7] == 'u' {
+					r2, ok = hex4(body, i+8)
+				}
+				if dec := utf16.DecodeRune(r, r2); ok && dec != utf8.RuneError {
+					r, n = dec, 12
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			out = utf8.AppendRune(out, r)
+		default:
+			out = append(out, body[i:i+2]...)
+		}
+		i += n
+		m.mark(len(out), off+i)
+	}
+	return out, true
+}
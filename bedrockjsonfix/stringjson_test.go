@@ -0,0 +1,114 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnwrapStringEncodedJSON(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty = false
+	opt.UnwrapStringEncodedJSON = true
+	tests := []struct {
+		input  string
+		want   string
+		layers int
+	}{
+		{`"{\"format_version\":\"1.20.0\"}"`, `{"format_version":"1.20.0"}`, 1},
+		{` "[1, 2,]" ` + "\n", `[1,2]`, 1},
+		{`"\"{\\\"a\\\":\\\"\\\\u00e9\\\"}\""`, `{"a":"\u00e9"}`, 2},
+		{`"{\"name\":\"café 😀\"}"`, `{"name":"café 😀"}`, 1},
+		{`"{\"a\": 1} // note"`, `"{\"a\": 1} // note"`, 0},
+		{`"[1] is a footnote"`, `"[1] is a footnote"`, 0},
+		{`"see {\"a\":1}"`, `"see {\"a\":1}"`, 0},
+		{`"just text"`, `"just text"`, 0},
+		{`"\"still text\""`, `"\"still text\""`, 0},
+		{`{"a":"{\"b\":1}"}`, `{"a":"{\"b\":1}"}`, 0},
+	}
+	for _, tt := range tests {
+		res, err := FixString(tt.input, opt)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if got := strings.TrimSpace(string(res.Output)); got != tt.want {
+			t.Fatalf("%s: output = %s, want %s", tt.input, got, tt.want)
+		}
+		if res.Report.UnwrappedStringLayers != tt.layers {
+			t.Fatalf("%s: UnwrappedStringLayers = %d, want %d", tt.input, res.Report.UnwrappedStringLayers, tt.layers)
+		}
+	}
+}
+
+func TestUnwrapStringEncodedJSONRisk(t *testing.T) {
+	opt := DefaultOptions()
+	opt.UnwrapStringEncodedJSON = true
+	for _, preserve := range []bool{false, true} {
+		opt.PreserveIfValid = preserve
+		opt.MaxRisk = RiskNone
+		res, err := FixString(`"{\"a\":1}"`, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Report.Repairs != RepairStringJSON || res.Report.Risk != RiskLossy {
+			t.Fatalf("preserve %v: repairs = %v, risk = %v, want string_json, lossy", preserve, res.Report.Repairs, res.Report.Risk)
+		}
+		if len(res.Warnings) != 1 || res.Warnings[0].Code != WarnStringJSONUnwrapped {
+			t.Fatalf("preserve %v: warnings = %+v, want %s", preserve, res.Warnings, WarnStringJSONUnwrapped)
+		}
+
+		opt.MaxRisk = RiskStructural
+		if _, err := FixString(`"{\"a\":1}"`, opt); !errors.Is(err, ErrRepairTooLossy) {
+			t.Fatalf("preserve %v: error = %v, want ErrRepairTooLossy", preserve, err)
+		}
+	}
+	opt.MaxRisk = RiskCosmetic
+	if _, err := FixString(`"[1] is a footnote"`, opt); err != nil {
+		t.Fatalf("plain string: %v", err)
+	}
+
+	opt.MaxRisk = RiskNone
+	opt.Fixes = RepairsBedrock &^ RepairStringJSON
+	res, err := FixString(`"{\"a\":1}"`, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Report.UnwrappedStringLayers != 0 {
+		t.Fatalf("layers = %d with RepairStringJSON cleared, want 0", res.Report.UnwrappedStringLayers)
+	}
+}
+
+func TestUnwrapStringEncodedJSONOff(t *testing.T) {
+	res, err := FixString(`"{\"a\":1}"`, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Root != RootUnknown || res.Report.UnwrappedStringLayers != 0 {
+		t.Fatalf("root = %v, layers = %d, want the string kept", res.Root, res.Report.UnwrappedStringLayers)
+	}
+}
+
+func TestUnwrapStringEncodedJSONPositions(t *testing.T) {
+	opt := DefaultOptions()
+	opt.UnwrapStringEncodedJSON = true
+	input := `"{\"a\": \"é\",\n \"b\" 2}"`
+	_, err := FixString(input, opt)
+	var fe *FixError
+	if !errors.As(err, &fe) {
+		t.Fatalf("error = %v, want a FixError", err)
+	}
+	if want := strings.Index(input, "2}"); fe.Offset != want {
+		t.Fatalf("error offset = %d, want %d in the encoded input", fe.Offset, want)
+	}
+
+	opt.BuildSourceMap = true
+	input = `"{\"x\":{\"y\":[1,2]}}"`
+	res, err := FixString(input, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := res.SourceMap.Lookup("/x/y/1")
+	if !ok || m.Input != strings.Index(input, "2]") {
+		t.Fatalf("mapping = %+v, %v, want input offset %d", m, ok, strings.Index(input, "2]"))
+	}
+}
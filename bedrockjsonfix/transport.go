@@ -0,0 +1,175 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// Transport encodings reported in Report.Transport.
+const (
+	TransportGzip      = "gzip"
+	TransportZlib      = "zlib"
+	TransportBase64    = "base64"
+	TransportBase64URL = "base64url"
+	// TransportDataURL is a data:application/json;base64, URL.
+	TransportDataURL = "data_url"
+)
+
+// maxTransportLayers bounds the encodings decodeTransport removes, such as
+// base64 around gzip.
+const maxTransportLayers = 4
+
+// errNotCompressed reports that data with a gzip or zlib header did not
+// decompress. Two bytes of text can look like a zlib header, so the data
+// is then taken as it is.
+var errNotCompressed = errors.New("not compressed")
+
+// decodeTransport removes the transport encodings around a document for
+// Options.DecodeTransport and returns the decoded bytes with the encodings
+// removed, outermost first. Decompressed data larger than limit is an
+// ErrInputTooLarge error. Only a data URL that does not decode is an
+// ErrTransportDecode error: when data chosen by its gzip or zlib header
+// does not decompress, the layers that led to it are not removed either.
+func decodeTransport(in []byte, limit int64) ([]byte, []string, error) {
+	var chain []string
+	base, kept := in, 0
+	for range maxTransportLayers {
+		out, name, err := decodeTransportLayer(in, limit)
+		if errors.Is(err, errNotCompressed) {
+			return base, chain[:kept], nil
+		}
+		if err != nil {
+			return nil, chain, err
+		}
+		if name == "" {
+			break
+		}
+		chain = append(chain, name)
+		in = out
+		if (name != TransportBase64 && name != TransportBase64URL) || !(isGzip(out) || isZlib(out)) {
+			// Base64 is only taken for compressed data once it decompresses.
+			base, kept = out, len(chain)
+		}
+	}
+	return in, chain, nil
+}
+
+func decodeTransportLayer(in []byte, limit int64) ([]byte, string, error) {
+	switch {
+	case isGzip(in):
+		zr, err := gzip.NewReader(bytes.NewReader(in))
+		if err != nil {
+			return nil, "", errNotCompressed
+		}
+		return decompress(zr, TransportGzip, limit)
+	case isZlib(in):
+		zr, err := zlib.NewReader(bytes.NewReader(in))
+		if err != nil {
+			return nil, "", errNotCompressed
+		}
+		return decompress(zr, TransportZlib, limit)
+	}
+	text := bytes.TrimSpace(in)
+	if payload, ok := dataURLPayload(text); ok {
+		out, _, err := decodeBase64(payload)
+		if err != nil {
+			return nil, "", transportError(TransportDataURL, err)
+		}
+		return out, TransportDataURL, nil
+	}
+	if out, name, err := decodeBase64(text); err == nil && plausiblePayload(out) {
+		return out, name, nil
+	}
+	return in, "", nil
+}
+
+func isGzip(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b
+}
+
+// isZlib matches a zlib header with the deflate method and a valid check
+// value (RFC 1950).
+func isZlib(b []byte) bool {
+	return len(b) >= 2 && b[0]&0x0f == 8 && b[0]>>4 <= 7 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+func decompress(r io.ReadCloser, name string, limit int64) ([]byte, string, error) {
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, "", errNotCompressed
+	}
+	if int64(len(out)) > limit {
+		return nil, "", &FixError{Code: "input_too_large", Message: fmt.Sprintf("%s input decompresses to more than %d bytes", name, limit), Cause: ErrInputTooLarge, Stage: StageTransport}
+	}
+	return out, name, nil
+}
+
+// dataURLPayload returns the data of a data: URL with a JSON media type
+// and base64 encoding, such as data:application/json;charset=utf-8;base64,.
+func dataURLPayload(b []byte) ([]byte, bool) {
+	const scheme = "data:"
+	if len(b) < len(scheme) || !bytes.EqualFold(b[:len(scheme)], []byte(scheme)) {
+		return nil, false
+	}
+	header, payload, ok := bytes.Cut(b[len(scheme):], []byte(","))
+	if !ok {
+		return nil, false
+	}
+	params := bytes.Split(header, []byte(";"))
+	media := bytes.ToLower(bytes.TrimSpace(params[0]))
+	if !bytes.Equal(media, []byte("application/json")) && !bytes.HasSuffix(media, []byte("+json")) {
+		return nil, false
+	}
+	last := bytes.TrimSpace(params[len(params)-1])
+	if len(params) < 2 || !bytes.EqualFold(last, []byte("base64")) {
+		return nil, false
+	}
+	return payload, true
+}
+
+// decodeBase64 decodes standard or URL-safe base64, with or without
+// padding and line breaks.
+func decodeBase64(b []byte) ([]byte, string, error) {
+	b = bytes.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, b)
+	b = bytes.TrimRight(b, "=")
+	enc, name := base64.RawStdEncoding, TransportBase64
+	if bytes.ContainsAny(b, "-_") {
+		enc, name = base64.RawURLEncoding, TransportBase64URL
+	}
+	out := make([]byte, enc.DecodedLen(len(b)))
+	n, err := enc.Decode(out, b)
+	if err != nil {
+		return nil, "", err
+	}
+	return out[:n], name, nil
+}
+
+// plausiblePayload reports whether base64-decoded bytes are worth decoding
+// further: compressed data, or text that starts like a document. Plain
+// words and numbers that happen to be valid base64 decode to neither.
+func plausiblePayload(b []byte) bool {
+	if isGzip(b) || isZlib(b) {
+		return true
+	}
+	if !utf8.Valid(b) {
+		return false
+	}
+	b = bytes.TrimPrefix(bytes.TrimSpace(b), []byte("\xEF\xBB\xBF"))
+	return len(b) > 0 && (b[0] == '{' || b[0] == '[' || b[0] == '"')
+}
+
+func transportError(name string, err error) *FixError {
+	return &FixError{Code: "transport_decode_failed", Message: name + ": " + err.Error(), Cause: errors.Join(ErrTransportDecode, err), Stage: StageTransport}
+}
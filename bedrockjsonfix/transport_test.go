@@ -0,0 +1,141 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func zlibBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDecodeTransport(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Pretty = false
+	opt.DecodeTransport = true
+	doc := []byte(`{"a": [1, 2,], "s": "~~~???"}`)
+	want := `{"a":[1,2],"s":"~~~???"}`
+	tests := []struct {
+		name  string
+		input []byte
+		chain []string
+	}{
+		{"gzip", gzipBytes(t, doc), []string{TransportGzip}},
+		{"zlib", zlibBytes(t, doc), []string{TransportZlib}},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(doc)), []string{TransportBase64}},
+		{"base64url unpadded", []byte(base64.RawURLEncoding.EncodeToString(doc)), []string{TransportBase64URL}},
+		{"base64 with line breaks", []byte(base64.StdEncoding.EncodeToString(doc)[:20] + "\r\n" + base64.StdEncoding.EncodeToString(doc)[20:] + "\n"), []string{TransportBase64}},
+		{"data url", []byte("data:application/json;base64," + base64.StdEncoding.EncodeToString(doc)), []string{TransportDataURL}},
+		{"data url with charset", []byte("DATA:application/json;charset=utf-8;base64," + base64.StdEncoding.EncodeToString(doc)), []string{TransportDataURL}},
+		{"base64 of gzip", []byte(base64.StdEncoding.EncodeToString(gzipBytes(t, doc))), []string{TransportBase64, TransportGzip}},
+		{"plain", doc, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := FixBytes(tt.input, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(res.Output)); got != want {
+				t.Fatalf("output = %s, want %s", got, want)
+			}
+			if !reflect.DeepEqual(res.Report.Transport(), tt.chain) {
+				t.Fatalf("Transport = %v, want %v", res.Report.Transport(), tt.chain)
+			}
+		})
+	}
+}
+
+func TestDecodeTransportLeavesText(t *testing.T) {
+	opt := DefaultOptions()
+	opt.DecodeTransport = true
+	for _, input := range []string{"1234", "true", `"abcd"`, "[1,2]"} {
+		res, err := FixString(input, opt)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if len(res.Report.Transport()) != 0 {
+			t.Fatalf("%s: Transport = %v, want none", input, res.Report.Transport())
+		}
+	}
+}
+
+func TestDecodeTransportLimits(t *testing.T) {
+	opt := DefaultOptions()
+	opt.DecodeTransport = true
+	opt.MaxInputBytes = 4 << 10
+	bomb := gzipBytes(t, []byte(`["`+strings.Repeat("a", 1<<20)+`"]`))
+	if int64(len(bomb)) > opt.MaxInputBytes {
+		t.Fatalf("compressed input is %d bytes", len(bomb))
+	}
+	_, err := FixBytes(bomb, opt)
+	var fe *FixError
+	if !errors.As(err, &fe) || !errors.Is(err, ErrInputTooLarge) || fe.Stage != StageTransport {
+		t.Fatalf("error = %v, want ErrInputTooLarge from the transport stage", err)
+	}
+
+	_, err = FixString("data:application/json;base64,!!!", opt)
+	if !errors.Is(err, ErrTransportDecode) {
+		t.Fatalf("error = %v, want ErrTransportDecode", err)
+	}
+}
+
+func TestDecodeTransportHeaderOnly(t *testing.T) {
+	opt := DefaultOptions()
+	opt.DecodeTransport = true
+	corrupt := []byte{0x1f, 0x8b, 0x08, 0x00, 0x01, '[', '1', ']'}
+	for _, input := range [][]byte{
+		[]byte(`x {"a":1}`),
+		[]byte(`x = {"a":1};`),
+		[]byte(`Hj {"a":1}`),
+		corrupt,
+		[]byte(base64.StdEncoding.EncodeToString(corrupt)),
+	} {
+		want, wantErr := FixBytes(input, DefaultOptions())
+		res, err := FixBytes(input, opt)
+		if (err == nil) != (wantErr == nil) || string(res.Output) != string(want.Output) {
+			t.Fatalf("%q: got %q, %v, want %q, %v as without DecodeTransport", input, res.Output, err, want.Output, wantErr)
+		}
+		if len(res.Report.Transport()) != 0 {
+			t.Fatalf("%q: Transport = %v, want none", input, res.Report.Transport())
+		}
+	}
+}
+
+func TestDecodeTransportPositions(t *testing.T) {
+	opt := DefaultOptions()
+	opt.DecodeTransport = true
+	_, err := FixBytes(gzipBytes(t, []byte("{\n  \"a\": 1\n  \"b\": 2\n}")), opt)
+	var fe *FixError
+	if !errors.As(err, &fe) || fe.Line != 3 || fe.Column != 3 {
+		t.Fatalf("error = %v, want line 3, column 3 of the decoded input", err)
+	}
+}
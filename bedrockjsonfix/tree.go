@@ -0,0 +1,342 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// NodeKind classifies a Node.
+type NodeKind int
+
+const (
+	// NodeObject is an object; its entries are members with keys.
+	NodeObject NodeKind = iota + 1
+	// NodeArray is an array; its entries are elements.
+	NodeArray
+	// NodeString is a string, with its lexeme kept as written.
+	NodeString
+	// NodeNumber is a number, with its lexeme kept as written.
+	NodeNumber
+	// NodeLiteral is true, false or null.
+	NodeLiteral
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case NodeObject:
+		return "object"
+	case NodeArray:
+		return "array"
+	case NodeString:
+		return "string"
+	case NodeNumber:
+		return "number"
+	case NodeLiteral:
+		return "literal"
+	}
+	return fmt.Sprintf("NodeKind(%d)", int(k))
+}
+
+// Tree is a concrete syntax tree of a JSON document. It keeps every byte of
+// the input, including whitespace, comments, trailing commas and the exact
+// lexemes of strings and numbers, so Bytes returns the input unchanged
+// until the tree is edited, and afterwards differs only in the edited
+// nodes and the commas and line breaks around them.
+//
+// A Tree is not safe for concurrent use.
+type Tree struct {
+	lead  []byte // BOM and trivia before the root
+	root  *Node
+	trail []byte // trivia after the root
+}
+
+// Node is a value of a Tree.
+type Node struct {
+	kind NodeKind
+	raw  []byte // lexeme of a scalar
+
+	members []*member
+	tail    []byte // trivia before the closing bracket
+}
+
+// member is one entry of an object or array with the trivia around it.
+// Serialized it is before, key, colon, value, then after and ',' when comma
+// is set. Trivia after a value that is not followed by a comma belongs to
+// the next entry or to the container's tail.
+type member struct {
+	before []byte
+	key    []byte // quoted key lexeme of an object member
+	name   string // decoded key
+	colon  []byte // from the end of key to the value, including ':'
+	value  *Node
+	after  []byte
+	comma  bool
+}
+
+// Kind returns the kind of n.
+func (n *Node) Kind() NodeKind { return n.kind }
+
+// Raw returns the text of n as it will be serialized: the original lexeme
+// of a scalar, or a container with its comments and whitespace.
+func (n *Node) Raw() []byte {
+	if n.kind != NodeObject && n.kind != NodeArray {
+		return n.raw
+	}
+	return n.appendTo(nil)
+}
+
+// Len returns the number of members of an object or elements of an array.
+func (n *Node) Len() int { return len(n.members) }
+
+// Keys returns the keys of an object in document order, including
+// duplicates.
+func (n *Node) Keys() []string {
+	if n.kind != NodeObject {
+		return nil
+	}
+	keys := make([]string, len(n.members))
+	for i, m := range n.members {
+		keys[i] = m.name
+	}
+	return keys
+}
+
+// Root returns the root value of t.
+func (t *Tree) Root() *Node { return t.root }
+
+// Bytes serializes t.
+func (t *Tree) Bytes() []byte {
+	dst := append([]byte(nil), t.lead...)
+	dst = t.root.appendTo(dst)
+	return append(dst, t.trail...)
+}
+
+func (n *Node) appendTo(dst []byte) []byte {
+	var open, close byte
+	switch n.kind {
+	case NodeObject:
+		open, close = '{', '}'
+	case NodeArray:
+		open, close = '[', ']'
+	default:
+		return append(dst, n.raw...)
+	}
+	dst = append(dst, open)
+	for _, m := range n.members {
+		dst = append(dst, m.before...)
+		dst = append(dst, m.key...)
+		dst = append(dst, m.colon...)
+		dst = m.value.appendTo(dst)
+		if m.comma {
+			dst = append(dst, m.after...)
+			dst = append(dst, ',')
+		}
+	}
+	dst = append(dst, n.tail...)
+	return append(dst, close)
+}
+
+// ParseTree parses input into a Tree. Input must be JSON except for what the
+// tree can keep verbatim: a BOM, comments and trailing commas, each allowed
+// when opt enables the corresponding repair. Other damage is an
+// ErrInvalidJSON error; run FixBytes first to repair it. MaxInputBytes and
+// MaxDepth apply.
+func ParseTree(input []byte, opt Options) (*Tree, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+	if int64(len(input)) > opt.MaxInputBytes {
+		return nil, inputTooLargeError(int64(len(input)), opt.MaxInputBytes)
+	}
+	fixes := opt.effectiveFixes()
+	p := &treeParser{
+		in:       input,
+		comments: fixes&(RepairLineComments|RepairBlockComments) != 0,
+		commas:   fixes&RepairTrailingCommas != 0,
+		maxDepth: opt.MaxDepth,
+	}
+	from := 0
+	if fixes&RepairBOM != 0 && bytes.HasPrefix(input, []byte("\xEF\xBB\xBF")) {
+		from = 3
+	}
+	p.lx = newTolerantLexer(input, from, true)
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	t := &Tree{lead: input[:p.tok.start]}
+	root, err := p.value(0)
+	if err != nil {
+		return nil, err
+	}
+	t.root = root
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf(p.tok.start, "unexpected data after root value")
+	}
+	t.trail = p.trivia()
+	return t, nil
+}
+
+type treeParser struct {
+	in  []byte
+	lx  tolerantLexer
+	tok lexToken // current token, after trivia
+	// trivStart is the start of the trivia before tok.
+	trivStart int
+
+	comments bool
+	commas   bool
+	maxDepth int
+}
+
+// advance moves to the next token that is not whitespace or a comment.
+func (p *treeParser) advance() error {
+	p.trivStart = p.lx.pos
+	for {
+		t := p.lx.next()
+		switch t.kind {
+		case tokWhitespace:
+			if t.flags&^flagCR != 0 {
+				return p.errorf(t.start, "invalid character in whitespace")
+			}
+			continue
+		case tokLineComment, tokBlockComment:
+			if !p.comments {
+				return p.errorf(t.start, "comments are not allowed")
+			}
+			if t.flags&flagUnterminated != 0 {
+				return p.errorf(t.start, "unterminated block comment")
+			}
+			continue
+		}
+		p.tok = t
+		return nil
+	}
+}
+
+func (p *treeParser) trivia() []byte { return p.in[p.trivStart:p.tok.start] }
+
+func (p *treeParser) isPunct(c byte) bool {
+	return p.tok.kind == tokPunct && p.in[p.tok.start] == c
+}
+
+// value parses the value at the current token and advances past it.
+func (p *treeParser) value(depth int) (*Node, error) {
+	t := p.tok
+	lexeme := p.in[t.start:t.end]
+	n := &Node{raw: lexeme}
+	switch t.kind {
+	case tokString:
+		if err := p.checkString(t); err != nil {
+			return nil, err
+		}
+		n.kind = NodeString
+	case tokNumber:
+		if !json.Valid(lexeme) {
+			return nil, p.errorf(t.start, "invalid number "+string(lexeme))
+		}
+		n.kind = NodeNumber
+	case tokLiteral:
+		n.kind = NodeLiteral
+	case tokPunct:
+		if c := lexeme[0]; c == '{' || c == '[' {
+			return p.container(c, depth+1)
+		}
+		fallthrough
+	default:
+		return nil, p.errorf(t.start, "expected a value")
+	}
+	return n, p.advance()
+}
+
+func (p *treeParser) checkString(t lexToken) error {
+	switch {
+	case t.flags&flagUnterminated != 0:
+		return p.errorf(t.start, "unterminated string")
+	case t.flags&(flagNewline|flagControl) != 0:
+		return p.errorf(t.start, "control character in string")
+	case !json.Valid(p.in[t.start:t.end]):
+		return p.errorf(t.start, "invalid escape in string")
+	}
+	return nil
+}
+
+func (p *treeParser) container(open byte, depth int) (*Node, error) {
+	start := p.tok.start
+	if p.maxDepth > 0 && depth > p.maxDepth {
+		pos := positionAt(p.in, start)
+		return nil, newLimitError(pos, snippetAt(p.in, pos), exceeded("MaxDepth", "nesting depth", p.maxDepth))
+	}
+	n := &Node{kind: NodeArray}
+	close := byte(']')
+	if open == '{' {
+		n.kind, close = NodeObject, '}'
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for {
+		triv := p.trivia()
+		if p.isPunct(close) {
+			if len(n.members) > 0 && n.members[len(n.members)-1].comma && !p.commas {
+				return nil, p.errorf(p.tok.start, "trailing commas are not allowed")
+			}
+			n.tail = triv
+			return n, p.advance()
+		}
+		if p.tok.kind == tokEOF {
+			return nil, p.errorf(start, fmt.Sprintf("unclosed %s", n.kind))
+		}
+		if len(n.members) > 0 && !n.members[len(n.members)-1].comma {
+			return nil, p.errorf(p.tok.start, fmt.Sprintf("expected ',' or '%c'", close))
+		}
+		m := &member{before: triv}
+		if n.kind == NodeObject {
+			if err := p.key(m); err != nil {
+				return nil, err
+			}
+		}
+		v, err := p.value(depth)
+		if err != nil {
+			return nil, err
+		}
+		m.value = v
+		if p.isPunct(',') {
+			m.after, m.comma = p.trivia(), true
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		n.members = append(n.members, m)
+	}
+}
+
+func (p *treeParser) key(m *member) error {
+	t := p.tok
+	if t.kind != tokString {
+		return p.errorf(t.start, "expected a string key")
+	}
+	if err := p.checkString(t); err != nil {
+		return err
+	}
+	m.key = p.in[t.start:t.end]
+	if err := json.Unmarshal(m.key, &m.name); err != nil {
+		return p.errorf(t.start, "invalid key")
+	}
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if !p.isPunct(':') {
+		return p.errorf(p.tok.start, "expected ':' after object key")
+	}
+	if err := p.advance(); err != nil {
+		return err
+	}
+	m.colon = p.in[t.end:p.tok.start]
+	return nil
+}
+
+func (p *treeParser) errorf(off int, reason string) error {
+	pos := positionAt(p.in, off)
+	return newInvalidJSONError(pos, snippetAt(p.in, pos), reason, nil, StageParse, 0)
+}
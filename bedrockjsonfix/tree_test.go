@@ -0,0 +1,205 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"testing"
+)
+
+const testManifest = "\xEF\xBB\xBF// Resource pack manifest\n{\n    \"format_version\": 2,\n    \"header\": {\n        \"name\": \"pack.name\", // localized\n        \"version\": [1, 0, 0],\n        \"min_engine_version\": [1, 20, 0]\n    },\n    /* modules */\n    \"modules\": [\n        {\"type\": \"resources\", \"version\": [1, 0, 0],},\n    ],\n    \"ratio\": 1.50e0\n}\n"
+
+func TestParseTreeRoundTrip(t *testing.T) {
+	tr, err := ParseTree([]byte(testManifest), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(tr.Bytes()); got != testManifest {
+		t.Fatalf("round trip changed the input:\n%s", got)
+	}
+	n, err := tr.Get("/ratio")
+	if err != nil || n.Kind() != NodeNumber || string(n.Raw()) != "1.50e0" {
+		t.Fatalf("unexpected /ratio %v %v", n, err)
+	}
+	n, err = tr.Get("/modules/0/version/2")
+	if err != nil || string(n.Raw()) != "0" {
+		t.Fatalf("unexpected /modules/0/version/2: %v", err)
+	}
+	if keys := tr.Root().Keys(); len(keys) != 4 || keys[1] != "header" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestTreeEditsKeepComments(t *testing.T) {
+	tr, err := ParseTree([]byte(testManifest), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		name string
+		edit func() error
+		want string
+	}{
+		{"bump version", func() error { return tr.Set("/header/version/2", 1) },
+			"\xEF\xBB\xBF// Resource pack manifest\n{\n    \"format_version\": 2,\n    \"header\": {\n        \"name\": \"pack.name\", // localized\n        \"version\": [1, 0, 1],\n        \"min_engine_version\": [1, 20, 0]\n    },\n    /* modules */\n    \"modules\": [\n        {\"type\": \"resources\", \"version\": [1, 0, 0],},\n    ],\n    \"ratio\": 1.50e0\n}\n"},
+		{"add dependency", func() error {
+			return tr.Set("/dependencies", []map[string]any{{"uuid": "x"}})
+		},
+			"\xEF\xBB\xBF// Resource pack manifest\n{\n    \"format_version\": 2,\n    \"header\": {\n        \"name\": \"pack.name\", // localized\n        \"version\": [1, 0, 1],\n        \"min_engine_version\": [1, 20, 0]\n    },\n    /* modules */\n    \"modules\": [\n        {\"type\": \"resources\", \"version\": [1, 0, 0],},\n    ],\n    \"ratio\": 1.50e0,\n    \"dependencies\": [\n        {\n            \"uuid\": \"x\"\n        }\n    ]\n}\n"},
+		{"delete name", func() error { return tr.Delete("/header/name") },
+			"\xEF\xBB\xBF// Resource pack manifest\n{\n    \"format_version\": 2,\n    \"header\": {\n        \"version\": [1, 0, 1],\n        \"min_engine_version\": [1, 20, 0]\n    },\n    /* modules */\n    \"modules\": [\n        {\"type\": \"resources\", \"version\": [1, 0, 0],},\n    ],\n    \"ratio\": 1.50e0,\n    \"dependencies\": [\n        {\n            \"uuid\": \"x\"\n        }\n    ]\n}\n"},
+		{"insert module field", func() error { return tr.Insert("/modules/0/uuid", "m") },
+			"\xEF\xBB\xBF// Resource pack manifest\n{\n    \"format_version\": 2,\n    \"header\": {\n        \"version\": [1, 0, 1],\n        \"min_engine_version\": [1, 20, 0]\n    },\n    /* modules */\n    \"modules\": [\n        {\"type\": \"resources\", \"version\": [1, 0, 0], \"uuid\": \"m\",},\n    ],\n    \"ratio\": 1.50e0,\n    \"dependencies\": [\n        {\n            \"uuid\": \"x\"\n        }\n    ]\n}\n"},
+		{"insert first element", func() error { return tr.Insert("/header/version/0", 0) },
+			"\xEF\xBB\xBF// Resource pack manifest\n{\n    \"format_version\": 2,\n    \"header\": {\n        \"version\": [0, 1, 0, 1],\n        \"min_engine_version\": [1, 20, 0]\n    },\n    /* modules */\n    \"modules\": [\n        {\"type\": \"resources\", \"version\": [1, 0, 0], \"uuid\": \"m\",},\n    ],\n    \"ratio\": 1.50e0,\n    \"dependencies\": [\n        {\n            \"uuid\": \"x\"\n        }\n    ]\n}\n"},
+		{"delete modules", func() error { return tr.Delete("/modules") },
+			"\xEF\xBB\xBF// Resource pack manifest\n{\n    \"format_version\": 2,\n    \"header\": {\n        \"version\": [0, 1, 0, 1],\n        \"min_engine_version\": [1, 20, 0]\n    },\n    \"ratio\": 1.50e0,\n    \"dependencies\": [\n        {\n            \"uuid\": \"x\"\n        }\n    ]\n}\n"},
+	}
+	for _, st := range steps {
+		if err := st.edit(); err != nil {
+			t.Fatalf("%s: %v", st.name, err)
+		}
+		if got := string(tr.Bytes()); got != st.want {
+			t.Fatalf("%s:\n%s\nwant:\n%s", st.name, got, st.want)
+		}
+	}
+}
+
+func TestTreeDeleteKeepsSameLineComment(t *testing.T) {
+	for _, tc := range []struct{ in, ptr, want string }{
+		{"{\n  \"a\": 1, // A\n  \"b\": 2\n}", "/b", "{\n  \"a\": 1 // A\n}"},
+		{"{\n  \"a\": 1, // A\n  // about b\n  \"b\": 2,\n  \"c\": 3\n}", "/b", "{\n  \"a\": 1, // A\n  \"c\": 3\n}"},
+		{"[1, 2, 3]", "/0", "[2, 3]"},
+		{"[1, 2, 3]", "/1", "[1, 3]"},
+		{"[1, 2, 3]", "/2", "[1, 2]"},
+		{"[1]", "/0", "[]"},
+		{"[1 /*x*/, 2]", "/1", "[1 /*x*/]"},
+		{"[1, /*y*/ 2]", "/0", "[/*y*/ 2]"},
+	} {
+		tr, err := ParseTree([]byte(tc.in), DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Delete(tc.ptr); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(tr.Bytes()); got != tc.want {
+			t.Fatalf("delete %s from %q: got %q want %q", tc.ptr, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTreeSetKeepsValueLayout(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"{\n  \"v\": [1, 2, 3]\n}", "{\n  \"v\": [1, 2, 4]\n}"},
+		{"{\n  \"v\": [1,2,3]\n}", "{\n  \"v\": [1,2,4]\n}"},
+		{"{\n  \"v\": 1\n}", "{\n  \"v\": [1, 2, 4]\n}"},
+		{"{\n  \"v\": [\n    1\n  ]\n}", "{\n  \"v\": [\n    1,\n    2,\n    4\n  ]\n}"},
+	} {
+		tr, err := ParseTree([]byte(tc.in), DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Set("/v", []int{1, 2, 4}); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(tr.Bytes()); got != tc.want {
+			t.Fatalf("set /v in %q: got %q want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTreeInsertLayouts(t *testing.T) {
+	for _, tc := range []struct{ in, ptr, want string }{
+		{`{"a":1}`, "/b", `{"a":1, "b":2}`},
+		{"{\n  \"a\": 1 // A\n}", "/b", "{\n  \"a\": 1, // A\n  \"b\": 2\n}"},
+		{"{\n}", "/b", "{\n  \"b\": 2\n}"},
+		{"[1,3]", "/1", "[1,2,3]"},
+		{"[]", "/-", "[2]"},
+		{`{"a~/b": {}}`, "/a~0~1b/c", `{"a~/b": {"c": 2}}`},
+	} {
+		tr, err := ParseTree([]byte(tc.in), DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Insert(tc.ptr, 2); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(tr.Bytes()); got != tc.want {
+			t.Fatalf("insert %s into %q: got %q want %q", tc.ptr, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTreeInsertMatchesInlineStyle(t *testing.T) {
+	dep := map[string]any{"c": []int{3, 4}}
+	for _, tc := range []struct{ in, want string }{
+		{`{"deps": [{"a": 1}, {"b": 2}]}`, `{"deps": [{"a": 1}, {"b": 2}, {"c": [3, 4]}]}`},
+		{`{"deps":[{"a":1},{"b":2}]}`, `{"deps":[{"a":1},{"b":2},{"c":[3,4]}]}`},
+		{`{"deps" : [{"a" : 1}]}`, `{"deps" : [{"a" : 1}, {"c" : [3, 4]}]}`},
+	} {
+		tr, err := ParseTree([]byte(tc.in), DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Insert("/deps/-", dep); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(tr.Bytes()); got != tc.want {
+			t.Fatalf("insert into %q: got %q want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTreePointerErrors(t *testing.T) {
+	tr, err := ParseTree([]byte(`{"a": [1], "s": "x"}`), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		code string
+		err  error
+	}{
+		{"pointer_not_found", tr.Delete("/missing")},
+		{"pointer_not_found", tr.Set("/a/1", 0)},
+		{"invalid_pointer", tr.Insert("/a", 0)},
+		{"invalid_pointer", tr.Set("/a/01", 0)},
+		{"invalid_pointer", tr.Set("/s/x", 0)},
+		{"invalid_pointer", tr.Set("a", 0)},
+		{"invalid_pointer", tr.Set("/~2", 0)},
+	} {
+		var fe *FixError
+		if !errors.As(tc.err, &fe) || fe.Code != tc.code || !errors.Is(tc.err, ErrInvalidPointer) {
+			t.Fatalf("expected %s, got %v", tc.code, tc.err)
+		}
+	}
+	if got := string(tr.Bytes()); got != `{"a": [1], "s": "x"}` {
+		t.Fatalf("failed edits changed the tree: %s", got)
+	}
+}
+
+func TestParseTreeRejects(t *testing.T) {
+	strict := DefaultOptions()
+	strict.Mode = ModeStrict
+	for _, tc := range []struct {
+		in  string
+		opt Options
+		col int
+	}{
+		{`{"a": 1,}`, strict, 9},
+		{"{\"a\": 1 // c\n}", strict, 9},
+		{`{"a" 1}`, DefaultOptions(), 6},
+		{`{"a": 01}`, DefaultOptions(), 7},
+		{`{"a": 1} x`, DefaultOptions(), 10},
+		{`[1 2]`, DefaultOptions(), 4},
+	} {
+		_, err := ParseTree([]byte(tc.in), tc.opt)
+		var fe *FixError
+		if !errors.As(err, &fe) || !errors.Is(err, ErrInvalidJSON) || fe.Column != tc.col {
+			t.Fatalf("%q: expected invalid_json at column %d, got %v", tc.in, tc.col, err)
+		}
+	}
+	opt := DefaultOptions()
+	opt.MaxDepth = 2
+	if _, err := ParseTree([]byte(`[[[1]]]`), opt); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	}
+}
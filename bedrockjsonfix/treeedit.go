@@ -0,0 +1,434 @@
+package bedrockjsonfix
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Get returns the node at pointer, a JSON Pointer (RFC 6901). "" is the
+// root. A key that appears more than once refers to its last occurrence,
+// the one encoding/json keeps.
+func (t *Tree) Get(pointer string) (*Node, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	return t.resolve(pointer, tokens)
+}
+
+// Set replaces the value at pointer with v encoded by encoding/json, or adds
+// it as the last member when pointer names a missing key of an object. The
+// new value is indented like its siblings when the container spans several
+// lines, unless the value it replaces fits on one line. On one line it is
+// spaced like the value it replaces, or else like the container.
+func (t *Tree) Set(pointer string, v any) error {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		_, unit, multiline := layout(t.root)
+		n, err := encodeNode(v, "", unit, multiline && spansLines(t.root), t.root)
+		if err != nil {
+			return err
+		}
+		t.root = n
+		return nil
+	}
+	parent, last, err := t.parent(pointer, tokens)
+	if err != nil {
+		return err
+	}
+	i, err := parent.find(pointer, last, false)
+	if err != nil {
+		return err
+	}
+	if i == parent.Len() {
+		return t.insert(pointer, parent, i, last, v)
+	}
+	indent, unit, multiline := layout(parent)
+	like := parent
+	if old := parent.members[i].value; len(old.members) > 0 {
+		like = old
+	}
+	n, err := encodeNode(v, indent, unit, multiline && spansLines(parent.members[i].value), like)
+	if err != nil {
+		return err
+	}
+	parent.members[i].value = n
+	return nil
+}
+
+// Insert adds v encoded by encoding/json at pointer. In an array the last
+// token is the index the new element takes, or "-" to append; in an object
+// it is a new key, which is appended after the existing members. The value
+// is laid out like the entries of its container.
+func (t *Tree) Insert(pointer string, v any) error {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return pointerError("invalid_pointer", pointer, "cannot insert at the root")
+	}
+	parent, last, err := t.parent(pointer, tokens)
+	if err != nil {
+		return err
+	}
+	i, err := parent.find(pointer, last, true)
+	if err != nil {
+		return err
+	}
+	return t.insert(pointer, parent, i, last, v)
+}
+
+// Delete removes the member or element at pointer together with the
+// comments before it, keeping a comment that shares a line with the
+// previous entry.
+func (t *Tree) Delete(pointer string) error {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return pointerError("invalid_pointer", pointer, "cannot delete the root")
+	}
+	parent, last, err := t.parent(pointer, tokens)
+	if err != nil {
+		return err
+	}
+	i, err := parent.find(pointer, last, false)
+	if err != nil {
+		return err
+	}
+	if i == parent.Len() {
+		return pointerError("pointer_not_found", pointer, "no such member")
+	}
+	parent.remove(i)
+	return nil
+}
+
+func (t *Tree) resolve(pointer string, tokens []string) (*Node, error) {
+	n := t.root
+	for _, tok := range tokens {
+		i, err := n.find(pointer, tok, false)
+		if err != nil {
+			return nil, err
+		}
+		if i == n.Len() {
+			return nil, pointerError("pointer_not_found", pointer, "no member "+strconv.Quote(tok))
+		}
+		n = n.members[i].value
+	}
+	return n, nil
+}
+
+func (t *Tree) parent(pointer string, tokens []string) (*Node, string, error) {
+	parent, err := t.resolve(pointer, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	if parent.kind != NodeObject && parent.kind != NodeArray {
+		return nil, "", pointerError("invalid_pointer", pointer, "parent is a "+parent.kind.String())
+	}
+	return parent, tokens[len(tokens)-1], nil
+}
+
+// find returns the index of the entry tok names in n, or n.Len() for a
+// missing object key and for "-". With insert set, an array index may be
+// n.Len() and an existing object key is an error.
+func (n *Node) find(pointer, tok string, insert bool) (int, error) {
+	switch n.kind {
+	case NodeObject:
+		for i := len(n.members) - 1; i >= 0; i-- {
+			if n.members[i].name == tok {
+				if insert {
+					return 0, pointerError("invalid_pointer", pointer, "member "+strconv.Quote(tok)+" already exists")
+				}
+				return i, nil
+			}
+		}
+		return len(n.members), nil
+	case NodeArray:
+		if tok == "-" {
+			return len(n.members), nil
+		}
+		i, err := strconv.Atoi(tok)
+		if err != nil || i < 0 || (len(tok) > 1 && tok[0] == '0') {
+			return 0, pointerError("invalid_pointer", pointer, "invalid array index "+strconv.Quote(tok))
+		}
+		if i > len(n.members) || (i == len(n.members) && !insert) {
+			return 0, pointerError("pointer_not_found", pointer, "array index "+tok+" out of range")
+		}
+		return i, nil
+	}
+	return 0, pointerError("invalid_pointer", pointer, "cannot index into a "+n.kind.String())
+}
+
+func (t *Tree) insert(pointer string, parent *Node, i int, key string, v any) error {
+	indent, unit, multiline := layout(parent)
+	n, err := encodeNode(v, indent, unit, multiline, parent)
+	if err != nil {
+		return err
+	}
+	m := &member{value: n}
+	if parent.kind == NodeObject {
+		m.name = key
+		m.key, _ = json.Marshal(key)
+		m.colon = []byte(": ")
+		if len(parent.members) > 0 && isPlainColon(parent.members[0].colon) {
+			m.colon = parent.members[0].colon
+		}
+	}
+	parent.insert(i, m)
+	return nil
+}
+
+// insert adds m at index i, moving line breaks and commas so that the
+// comments around the neighbouring entries stay where they were.
+func (n *Node) insert(i int, m *member) {
+	switch {
+	case len(n.members) == 0:
+		if hasNewline(n.tail) {
+			head, rest := splitTrivia(n.tail)
+			m.before = concat(head, lineIndent(rest), []byte(defaultIndentUnit))
+			n.tail = concat([]byte{'\n'}, rest)
+		}
+	case i == len(n.members):
+		last := n.members[i-1]
+		if last.comma {
+			m.comma = true
+		} else {
+			last.comma, last.after = true, nil
+		}
+		if hasNewline(n.tail) {
+			head, rest := splitTrivia(n.tail)
+			m.before = concat(head, lineIndent(last.before))
+			n.tail = concat([]byte{'\n'}, rest)
+		} else {
+			m.before = inlineSeparator(n)
+		}
+	default:
+		next := n.members[i]
+		m.comma = true
+		if hasNewline(next.before) {
+			head, rest := splitTrivia(next.before)
+			m.before = concat(head, lineIndent(next.before))
+			next.before = concat([]byte{'\n'}, rest)
+		} else {
+			m.before = next.before
+			if i == 0 {
+				next.before = inlineSeparator(n)
+			}
+		}
+	}
+	n.members = append(n.members, nil)
+	copy(n.members[i+1:], n.members[i:])
+	n.members[i] = m
+}
+
+// remove deletes the entry at index i, keeping the comment that shares a
+// line with the previous entry and the comments before the next one.
+func (n *Node) remove(i int) {
+	m := n.members[i]
+	switch {
+	case len(n.members) == 1:
+	case i == len(n.members)-1:
+		prev := n.members[i-1]
+		if hasNewline(m.before) {
+			head, _ := splitTrivia(m.before)
+			tail := n.tail
+			if hasNewline(tail) {
+				_, tail = splitTrivia(tail)
+			}
+			n.tail = concat(head, tail)
+		}
+		if !m.comma {
+			// Without its comma, the trivia after prev belongs to the tail.
+			n.tail = concat(prev.after, n.tail)
+			prev.comma, prev.after = false, nil
+		}
+	default:
+		next := n.members[i+1]
+		switch {
+		case !hasNewline(next.before):
+			next.before = concat(m.before, bytes.TrimLeft(next.before, " \t"))
+		case hasNewline(m.before):
+			head, _ := splitTrivia(m.before)
+			_, rest := splitTrivia(next.before)
+			next.before = concat(head, rest)
+		}
+	}
+	n.members = append(n.members[:i], n.members[i+1:]...)
+}
+
+const defaultIndentUnit = "  "
+
+// layout returns the indentation of the entries of n and the unit it is
+// indented by relative to its closing bracket, when n spans several lines.
+func layout(n *Node) (indent, unit string, multiline bool) {
+	if len(n.members) == 0 || !hasNewline(n.members[0].before) {
+		return "", "", false
+	}
+	indent = string(lineIndent(n.members[0].before))
+	outer := ""
+	if hasNewline(n.tail) {
+		outer = string(lineIndent(n.tail))
+	}
+	unit = defaultIndentUnit
+	if rest, ok := strings.CutPrefix(indent, outer); ok && rest != "" {
+		unit = rest
+	}
+	return indent, unit, true
+}
+
+// encodeNode encodes v as a Node, indented with prefix and unit when
+// multiline is set, or else on one line spaced like the entries of like.
+func encodeNode(v any, prefix, unit string, multiline bool, like *Node) (*Node, error) {
+	var data []byte
+	var err error
+	if multiline {
+		data, err = json.MarshalIndent(v, prefix, unit)
+	} else if data, err = json.Marshal(v); err == nil {
+		sep, colon := inlineSeparator(like), []byte(": ")
+		if c := firstColon(like); c != nil {
+			colon = c
+		}
+		data = spaceJSON(data, sep, colon)
+	}
+	if err != nil {
+		return nil, &FixError{Code: "invalid_value", Message: err.Error(), Cause: err}
+	}
+	p := &treeParser{in: data, lx: newTolerantLexer(data, 0, false)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return p.value(0)
+}
+
+// splitTrivia splits b after its first line break outside a comment. head
+// is all of b when it has none.
+func splitTrivia(b []byte) (head, rest []byte) {
+	lx := newTolerantLexer(b, 0, true)
+	for t := lx.next(); t.kind != tokEOF; t = lx.next() {
+		if t.kind != tokWhitespace {
+			continue
+		}
+		if j := bytes.IndexByte(b[t.start:t.end], '\n'); j >= 0 {
+			return b[:t.start+j+1], b[t.start+j+1:]
+		}
+	}
+	return b, nil
+}
+
+// spansLines reports whether the serialized n contains a line break.
+func spansLines(n *Node) bool {
+	return bytes.IndexByte(n.Raw(), '\n') >= 0
+}
+
+func hasNewline(b []byte) bool {
+	_, rest := splitTrivia(b)
+	return rest != nil
+}
+
+// lineIndent returns the spaces and tabs that start the last line of b.
+func lineIndent(b []byte) []byte {
+	line := b[bytes.LastIndexByte(b, '\n')+1:]
+	i := 0
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	return line[:i]
+}
+
+// inlineSeparator returns the whitespace to put before an entry of a
+// single-line container: the separator the container already uses, or a
+// space.
+func inlineSeparator(n *Node) []byte {
+	if len(n.members) > 1 {
+		if b := n.members[len(n.members)-1].before; len(bytes.Trim(b, " \t")) == 0 {
+			return b
+		}
+	}
+	return []byte{' '}
+}
+
+func isPlainColon(b []byte) bool {
+	return string(bytes.Trim(b, " \t\r\n")) == ":"
+}
+
+// firstColon returns the first plain colon between a key and its value in
+// n, or nil.
+func firstColon(n *Node) []byte {
+	for _, m := range n.members {
+		if n.kind == NodeObject && isPlainColon(m.colon) && !hasNewline(m.colon) {
+			return m.colon
+		}
+		if c := firstColon(m.value); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// spaceJSON writes sep after each comma and colon for each colon of the
+// compact JSON data.
+func spaceJSON(data, sep, colon []byte) []byte {
+	if len(sep) == 0 && string(colon) == ":" {
+		return data
+	}
+	out := make([]byte, 0, len(data)+len(data)/4)
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '"':
+			j := i + 1
+			for ; data[j] != '"'; j++ {
+				if data[j] == '\\' {
+					j++
+				}
+			}
+			out = append(out, data[i:j+1]...)
+			i = j
+		case ',':
+			out = append(append(out, ','), sep...)
+		case ':':
+			out = append(out, colon...)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, pointerError("invalid_pointer", pointer, "pointer must start with '/'")
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, tok := range tokens {
+		for j := 0; j < len(tok); j++ {
+			if tok[j] == '~' && (j+1 == len(tok) || (tok[j+1] != '0' && tok[j+1] != '1')) {
+				return nil, pointerError("invalid_pointer", pointer, "invalid escape in pointer")
+			}
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func pointerError(code, pointer, msg string) error {
+	return &FixError{Code: code, Message: strconv.Quote(pointer) + ": " + msg, Cause: ErrInvalidPointer}
+}
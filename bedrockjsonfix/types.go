@@ -1,6 +1,8 @@
 package bedrockjsonfix
 
 import (
+	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -33,6 +35,18 @@ const (
 	RootUnknown
 )
 
+// Output selects the format FixBytes writes.
+type Output int
+
+const (
+	// OutputJSON writes strict JSON.
+	OutputJSON Output = iota
+	// OutputJSONC writes pretty-printed JSON with the input's line and
+	// block comments placed next to the members they preceded. Every other
+	// repair still applies. It requires Pretty.
+	OutputJSONC
+)
+
 // RootPolicy controls how parser fallback may scan for another root candidate.
 type RootPolicy int
 
@@ -72,22 +86,109 @@ type Options struct {
 	RootValidator func(kind RootKind, raw []byte, parsed any) bool
 
 	EscapeStringControls bool
+
+	// Fixes selects the repairs the Bedrock pipeline may apply. Zero means
+	// RepairsBedrock. The older switches (AllowCP1252Fallback,
+	// DropJunkOutsideStrings, TrimToFirstRoot, TrimAfterFirstRoot,
+	// EscapeStringControls, AggressiveWhitespace, RootPolicyFirst) still
+	// disable their repairs. ModeStrict applies no repairs.
+	Fixes Repair
+
+	// BuildSourceMap fills Result.SourceMap so output positions can be traced
+	// back to the original input.
+	BuildSourceMap bool
+
+	// MaxRisk refuses output whose repairs exceed this risk with
+	// ErrRepairTooLossy. RiskNone disables the check.
+	MaxRisk Risk
+	// MaxDroppedJunkBytes refuses output when more bytes than this were
+	// dropped or trimmed as junk. Trimmed whitespace is not counted. Zero
+	// disables the check.
+	MaxDroppedJunkBytes int64
+
+	// StreamWindowBytes is the read window of FixStream. Every token must
+	// fit in it. Zero means 1 MiB; other values must be at least 64.
+	StreamWindowBytes int
+
+	// BatchFailFast stops FixBatch at the first input that fails. By
+	// default failures are recorded and the batch continues.
+	BatchFailFast bool
+
+	// Structural limits, enforced token by token before any value tree is
+	// built. A violation returns ErrLimitExceeded. MaxDepth bounds container
+	// nesting, MaxStringBytes the raw bytes between the quotes of a string
+	// or key, MaxObjectMembers and MaxArrayElements the entries of a single
+	// container, and MaxTokens the strings, numbers, literals and
+	// punctuation of the document. Zero means unlimited.
+	MaxDepth         int
+	MaxStringBytes   int
+	MaxObjectMembers int
+	MaxArrayElements int
+	MaxTokens        int
+
+	// Stages are custom stages run by FixBytes around the built-in decode
+	// and cleanup stages. They disable the PreserveIfValid fast path, since
+	// a stage may rewrite valid JSON, and cannot be used with FixStream.
+	Stages []StageAt
+
+	// Output selects strict JSON or JSONC output. OutputJSONC cannot be
+	// combined with BuildSourceMap or used with FixStream.
+	Output Output
+
+	// ExtractMinBytes is the shortest span ExtractAll reports. Zero means
+	// 6 bytes.
+	ExtractMinBytes int
+
+	// UnwrapMarkdown takes the document out of a Markdown or chat message
+	// before decoding: from a fenced code block, preferring one tagged
+	// json, jsonc or json5, or else from an inline code span, without
+	// blockquote prefixes and spoiler bars. Report.Markdown is the span
+	// used. Unwrapping is the structural RepairMarkdown. It cannot be used
+	// with FixStream.
+	UnwrapMarkdown bool
+
+	// UnwrapStringEncodedJSON decodes a document sent as a JSON string,
+	// such as "{\"a\":1}", before repairing it, through as many layers of
+	// encoding as there are. Only strings whose whole contents are one
+	// object or array are unwrapped; Report.UnwrappedStringLayers is the
+	// depth. Unwrapping is the lossy RepairStringJSON, so MaxRisk below
+	// RiskLossy rejects it. It cannot be used with FixStream.
+	UnwrapStringEncodedJSON bool
+
+	// DecodeTransport detects and removes transport encodings before
+	// anything else: gzip and zlib streams, standard and URL-safe base64
+	// and data:application/json;base64, URLs, also nested. MaxInputBytes
+	// applies to the decompressed size as well. Report.Transport lists the
+	// encodings, and error positions and source maps refer to the decoded
+	// bytes. It cannot be used with FixStream.
+	DecodeTransport bool
 }
 
 // Warning represents a non-fatal observation.
 type Warning struct {
-	Code    string
-	Message string
+	// Code is one of the stable Warn* constants.
+	Code     string
+	Severity Severity
+	Message  string
 }
 
-// Report describes applied fixes and parsing decisions.
+// Span is the byte range [Start,End) of an input.
+type Span struct {
+	Start, End int
+}
+
+// Report describes applied fixes and parsing decisions. Reports compare
+// with == unless they list stages, rules or transport encodings, which are
+// held behind a pointer and read with Stages, Rules and Transport.
 type Report struct {
 	InputWasInvalidUTF8 bool
 	UsedCP1252Fallback  bool
 
 	RemovedBOM                  int
 	ReplacedNBSP                int
+	ReplacedNBSPInStrings       int
 	RemovedZeroWidth            int
+	RemovedZeroWidthInStrings   int
 	RemovedASCIIControls        int
 	NormalizedCRLF              int
 	EscapedStringControls       int
@@ -104,6 +205,77 @@ type Report struct {
 	RootScanAttemptsUsed      int
 
 	ValidJSON bool
+
+	// Repairs is the set of repairs that were applied.
+	Repairs Repair
+	// Risk is the highest risk among Repairs.
+	Risk Risk
+
+	// KeptComments counts the comments written to OutputJSONC output.
+	KeptComments int
+
+	// CodeWrapper names the JavaScript wrapper RepairCodeWrapper removed,
+	// one of the Wrapper* constants, or is empty.
+	CodeWrapper string
+
+	// UnwrappedStringLayers counts the layers of string encoding
+	// Options.UnwrapStringEncodedJSON removed.
+	UnwrappedStringLayers int
+
+	// Markdown is the span of the input Options.UnwrapMarkdown took the
+	// document from, such as the contents of a code fence. It is zero when
+	// the input was used as is.
+	Markdown Span
+
+	lists *reportLists
+}
+
+// reportLists are the parts of a Report that are slices. A Report never
+// modifies the lists it points to; see Report.editLists.
+type reportLists struct {
+	stages    []StageCount
+	rules     []RuleHit
+	transport []string
+}
+
+// Stages counts the changes of each custom stage that ran, in the order
+// the stages first ran.
+func (r Report) Stages() []StageCount {
+	if r.lists == nil {
+		return nil
+	}
+	return r.lists.stages
+}
+
+// Rules counts the matches of each repair rule that matched, by rule ID, in
+// rule file order.
+func (r Report) Rules() []RuleHit {
+	if r.lists == nil {
+		return nil
+	}
+	return r.lists.rules
+}
+
+// Transport lists the encodings Options.DecodeTransport removed, outermost
+// first, as Transport* constants.
+func (r Report) Transport() []string {
+	if r.lists == nil {
+		return nil
+	}
+	return r.lists.transport
+}
+
+// editLists gives r its own copy of its lists to modify, so copies of r
+// taken earlier keep theirs.
+func (r *Report) editLists() *reportLists {
+	l := &reportLists{}
+	if r.lists != nil {
+		l.stages = slices.Clone(r.lists.stages)
+		l.rules = slices.Clone(r.lists.rules)
+		l.transport = slices.Clone(r.lists.transport)
+	}
+	r.lists = l
+	return l
 }
 
 // Result is the output of a normalization run.
@@ -112,6 +284,13 @@ type Result struct {
 	Root     RootKind
 	Report   Report
 	Warnings []Warning
+
+	// SourceMap is set when Options.BuildSourceMap is enabled.
+	SourceMap *SourceMap
+
+	// Offset is the input offset of the document in a Decoder stream or in
+	// the text given to ExtractAll.
+	Offset int64
 }
 
 // DefaultOptions returns safe defaults for public services.
@@ -134,6 +313,8 @@ func DefaultOptions() Options {
 		WrongStartMaxOffset:    64,
 		RootScanAttempts:       5,
 		EscapeStringControls:   true,
+		Fixes:                  RepairsBedrock,
+		MaxDepth:               defaultMaxDepth,
 	}
 }
 
@@ -157,6 +338,35 @@ func (o *Options) Validate() error {
 	if o.Mode != ModeStrict && o.Mode != ModeBedrock && o.Mode != ModeBedrockSafe {
 		return &FixError{Code: "invalid_options", Message: "unknown mode", Cause: ErrOptionsInvalid}
 	}
+	if o.MaxRisk < RiskNone || o.MaxRisk > RiskLossy {
+		return &FixError{Code: "invalid_options", Message: "unknown max risk", Cause: ErrOptionsInvalid}
+	}
+	if o.Fixes&^RepairsBedrock != 0 {
+		return &FixError{Code: "invalid_options", Message: "unknown repair in fixes", Cause: ErrOptionsInvalid}
+	}
+	if o.MaxDroppedJunkBytes < 0 {
+		return &FixError{Code: "invalid_options", Message: "max dropped junk bytes cannot be negative", Cause: ErrOptionsInvalid}
+	}
+	if o.StreamWindowBytes != 0 && o.StreamWindowBytes < minStreamWindowBytes {
+		return &FixError{Code: "invalid_options", Message: fmt.Sprintf("stream window must be zero or at least %d bytes", minStreamWindowBytes), Cause: ErrOptionsInvalid}
+	}
+	if o.ExtractMinBytes < 0 {
+		return &FixError{Code: "invalid_options", Message: "extract min bytes cannot be negative", Cause: ErrOptionsInvalid}
+	}
+	if o.MaxDepth < 0 || o.MaxStringBytes < 0 || o.MaxObjectMembers < 0 || o.MaxArrayElements < 0 || o.MaxTokens < 0 {
+		return &FixError{Code: "invalid_options", Message: "structural limits cannot be negative", Cause: ErrOptionsInvalid}
+	}
+	switch {
+	case o.Output != OutputJSON && o.Output != OutputJSONC:
+		return &FixError{Code: "invalid_options", Message: "unknown output format", Cause: ErrOptionsInvalid}
+	case o.Output == OutputJSONC && !o.Pretty:
+		return &FixError{Code: "invalid_options", Message: "JSONC output requires Pretty", Cause: ErrOptionsInvalid}
+	case o.Output == OutputJSONC && o.BuildSourceMap:
+		return &FixError{Code: "invalid_options", Message: "JSONC output cannot be combined with BuildSourceMap", Cause: ErrOptionsInvalid}
+	}
+	if err := validateStages(o.Stages); err != nil {
+		return err
+	}
 	if o.RootPolicy != RootPolicyFirst && o.RootPolicy != RootPolicyScanLeadingJunk && o.RootPolicy != RootPolicyScanBestEffort {
 		return &FixError{Code: "invalid_options", Message: "unknown root policy", Cause: ErrOptionsInvalid}
 	}
@@ -172,3 +382,42 @@ func (o Options) effectiveRootScanMaxCandidates() int {
 	}
 	return 0
 }
+
+// effectiveFixes combines Fixes with the mode and the older per-repair switches.
+func (o Options) effectiveFixes() Repair {
+	if o.Mode == ModeStrict {
+		return 0
+	}
+	f := o.Fixes
+	if f == 0 {
+		f = RepairsBedrock
+	}
+	if !o.AllowCP1252Fallback {
+		f &^= RepairCP1252
+	}
+	if !o.AggressiveWhitespace {
+		f &^= RepairStringWhitespace
+	}
+	if !o.DropJunkOutsideStrings {
+		f &^= RepairDropJunk
+	}
+	if !o.TrimToFirstRoot {
+		f &^= RepairLeadingJunk
+	}
+	if !o.TrimAfterFirstRoot {
+		f &^= RepairTrailingJunk
+	}
+	if !o.EscapeStringControls {
+		f &^= RepairStringControls
+	}
+	if o.RootPolicy == RootPolicyFirst {
+		f &^= RepairRootScan
+	}
+	if !o.UnwrapStringEncodedJSON {
+		f &^= RepairStringJSON
+	}
+	if !o.UnwrapMarkdown {
+		f &^= RepairMarkdown
+	}
+	return f
+}
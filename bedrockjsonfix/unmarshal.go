@@ -0,0 +1,70 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Unmarshal repairs data like FixBytes and decodes the result into v.
+//
+// Object keys match struct fields case-sensitively, since Bedrock keys are
+// case-sensitive; use the `case:ignore` option of the json tag to opt out
+// per field. Duplicate keys are accepted and the last one wins. Decoding
+// follows encoding/json/v2 otherwise. Before Go 1.27, which has no
+// encoding/json/v2, decoding uses encoding/json, and members whose key
+// matches a field only case-insensitively are ignored as under v2.
+//
+// Repair errors are returned as from FixBytes. A value that does not fit v
+// returns an ErrUnmarshal error positioned at the value in the original
+// input.
+func Unmarshal(data []byte, v any, opt Options) (Report, error) {
+	if err := opt.Validate(); err != nil {
+		return Report{}, err
+	}
+	fixOpt := opt
+	fixOpt.Pretty, fixOpt.Output, fixOpt.BuildSourceMap = false, OutputJSON, false
+	res, err := FixBytes(data, fixOpt)
+	if err != nil {
+		return Report{}, err
+	}
+	if err := decodeJSON(res.Output, v); err != nil {
+		return res.Report, unmarshalError(data, fixOpt, err)
+	}
+	return res.Report, nil
+}
+
+// Decode is Unmarshal into a new value of type T.
+func Decode[T any](data []byte, opt Options) (T, Report, error) {
+	var v T
+	rep, err := Unmarshal(data, &v, opt)
+	return v, rep, err
+}
+
+// unmarshalError positions a decoding error at the value it names in the
+// original input. The repair runs again with a source map, which only the
+// failing path pays for; opt must be the options of the first run so the
+// error's byte offset still applies.
+func unmarshalError(input []byte, opt Options, err error) error {
+	fe := &FixError{Code: "unmarshal_failed", Message: err.Error(), Cause: errors.Join(ErrUnmarshal, err), Stage: StageUnmarshal}
+	pointer, outOff, ok := decodeErrorAt(err)
+	if !ok {
+		return fe
+	}
+	opt.BuildSourceMap = true
+	res, ferr := FixBytes(input, opt)
+	if ferr != nil || res.SourceMap == nil {
+		return fe
+	}
+	m, ok := res.SourceMap.Lookup(pointer)
+	off := m.Input
+	if pointer == "" || !ok {
+		if off, ok = res.SourceMap.InputOffset(int(outOff)); !ok {
+			return fe
+		}
+	}
+	fe.Position = positionAt(input, off)
+	fe.Snippet = snippetAt(input, fe.Position)
+	fe.Reason = err.Error()
+	fe.Message = fmt.Sprintf("line %d, column %d: %s", fe.Line, fe.Column, err)
+	return fe
+}
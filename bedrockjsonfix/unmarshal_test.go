@@ -0,0 +1,57 @@
+package bedrockjsonfix
+
+import (
+	"errors"
+	"testing"
+)
+
+type testManifestHeader struct {
+	Name    string `json:"name"`
+	Version []int  `json:"version"`
+}
+
+type testPackManifest struct {
+	FormatVersion int                `json:"format_version"`
+	Header        testManifestHeader `json:"header"`
+}
+
+func TestUnmarshalTolerantInput(t *testing.T) {
+	in := "\xEF\xBB\xBF{\n  // pack\n  \"format_version\": 2,\n  \"header\": {\"name\": \"pack\", \"version\": [1, 2, 3,],},\n}"
+	var m testPackManifest
+	rep, err := Unmarshal([]byte(in), &m, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.FormatVersion != 2 || m.Header.Name != "pack" || len(m.Header.Version) != 3 {
+		t.Fatalf("unexpected value %+v", m)
+	}
+	if rep.RemovedBOM != 1 || rep.StrippedLineComments != 1 || rep.RemovedTrailingCommas != 3 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+}
+
+func TestUnmarshalMatchesKeysCaseSensitively(t *testing.T) {
+	m, _, err := Decode[testPackManifest]([]byte(`{"Format_Version": 3, "header": {"NAME": "x", "name": "y", "name": "z"}}`), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.FormatVersion != 0 || m.Header.Name != "z" {
+		t.Fatalf("expected exact keys only with the last duplicate winning, got %+v", m)
+	}
+}
+
+func TestUnmarshalTypeErrorPosition(t *testing.T) {
+	in := "// header\n{\n  \"format_version\": 2,\n  \"header\": {\n    \"name\": \"pack\",\n    \"version\": [1, \"two\", 3]\n  }\n}"
+	_, _, err := Decode[testPackManifest]([]byte(in), DefaultOptions())
+	var fe *FixError
+	if !errors.As(err, &fe) || !errors.Is(err, ErrUnmarshal) || fe.Code != "unmarshal_failed" || fe.Stage != StageUnmarshal {
+		t.Fatalf("expected unmarshal_failed, got %v", err)
+	}
+	if fe.Line != 6 || fe.Column != 20 || fe.Snippet == "" {
+		t.Fatalf("expected error at 6:20, got %d:%d (%v)", fe.Line, fe.Column, err)
+	}
+
+	if _, err := Unmarshal([]byte(`{"a": oops`), new(testPackManifest), DefaultOptions()); !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("expected repair errors to pass through, got %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+//go:build !go1.27
+
+package bedrockjsonfix
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// decodeJSON decodes strict JSON into v with encoding/json, for toolchains
+// without encoding/json/v2. encoding/json matches keys case-insensitively,
+// so members whose key matches a struct field only that way are blanked
+// first and ignored, as encoding/json/v2 does. The last of duplicate keys
+// wins.
+func decodeJSON(data []byte, v any) error {
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Pointer && len(data) > 0 {
+		f := exactKeys{in: data}
+		f.value(0, t.Elem())
+		if f.out != nil {
+			data = f.out
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeErrorAt returns the output offset of the value a decodeJSON error
+// names. encoding/json reports no JSON Pointer.
+func decodeErrorAt(err error) (pointer string, offset int64, ok bool) {
+	var te *json.UnmarshalTypeError
+	if !errors.As(err, &te) {
+		return "", 0, false
+	}
+	return "", te.Offset, true
+}
+
+// exactKeys walks strict JSON along the Go type it decodes into and blanks
+// the members whose key matches a field only case-insensitively. Blanked
+// members, with a comma next to them, become spaces, so the offsets in
+// decoding errors still apply to the input.
+type exactKeys struct {
+	in  []byte
+	out []byte // copy of in, once a member is blanked
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// value walks the value at in[i:] decoded into t, which is nil when the
+// keys below it are not matched against fields, and returns its end.
+func (f *exactKeys) value(i int, t reflect.Type) int {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil {
+		if p := reflect.PointerTo(t); p.Implements(jsonUnmarshalerType) || p.Implements(textUnmarshalerType) {
+			t = nil
+		}
+	}
+	i = f.space(i)
+	if i >= len(f.in) {
+		return i
+	}
+	switch f.in[i] {
+	case '{':
+		return f.object(i, t)
+	case '[':
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		i = f.space(i + 1)
+		for i < len(f.in) && f.in[i] != ']' {
+			i = f.space(f.value(i, elem))
+			if i < len(f.in) && f.in[i] == ',' {
+				i = f.space(i + 1)
+			}
+		}
+		return i + 1
+	case '"':
+		return f.str(i)
+	}
+	for i < len(f.in) && !isStrictDelimiter(f.in[i]) {
+		i++
+	}
+	return i
+}
+
+// object walks the object at in[i:] decoded into t.
+func (f *exactKeys) object(i int, t reflect.Type) int {
+	var fields *structKeys
+	var elem reflect.Type
+	switch {
+	case t == nil:
+	case t.Kind() == reflect.Struct:
+		fields = keysOf(t)
+	case t.Kind() == reflect.Map:
+		elem = t.Elem()
+	}
+	kept, comma := false, -1
+	i = f.space(i + 1)
+	for i < len(f.in) && f.in[i] != '}' {
+		start := i
+		end := f.str(i)
+		ft, drop := elem, false
+		if fields != nil {
+			ft, drop = fields.lookup(f.key(f.in[start:end]))
+		}
+		i = f.space(end)
+		i = f.value(f.space(i+1), ft)
+		next := f.space(i)
+		switch {
+		case !drop:
+			kept = true
+		case kept:
+			f.blank(comma, i)
+		case next < len(f.in) && f.in[next] == ',':
+			f.blank(start, next+1)
+		default:
+			f.blank(start, i)
+		}
+		comma = -1
+		if next < len(f.in) && f.in[next] == ',' {
+			comma = next
+			next = f.space(next + 1)
+		}
+		i = next
+	}
+	return i + 1
+}
+
+// str returns the end of the string at in[i:].
+func (f *exactKeys) str(i int) int {
+	for i++; i < len(f.in); i++ {
+		switch f.in[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return i
+}
+
+// key decodes a quoted key.
+func (f *exactKeys) key(raw []byte) string {
+	if len(raw) >= 2 && !strings.Contains(string(raw), `\`) {
+		return string(raw[1 : len(raw)-1])
+	}
+	var s string
+	_ = json.Unmarshal(raw, &s)
+	return s
+}
+
+func (f *exactKeys) space(i int) int {
+	for i < len(f.in) && isSpace(f.in[i]) {
+		i++
+	}
+	return i
+}
+
+// blank turns in[start:end] into spaces in out.
+func (f *exactKeys) blank(start, end int) {
+	if f.out == nil {
+		f.out = append([]byte(nil), f.in...)
+	}
+	for i := start; i < end; i++ {
+		f.out[i] = ' '
+	}
+}
+
+// structKeys are the keys encoding/json matches against the fields of a
+// struct type.
+type structKeys struct {
+	exact map[string]reflect.Type
+	// folded are the names of fields matched case-insensitively under
+	// encoding/json/v2 too, by the `case:ignore` tag option.
+	folded map[string]reflect.Type
+}
+
+var structKeysCache sync.Map // reflect.Type -> *structKeys
+
+func keysOf(t reflect.Type) *structKeys {
+	if k, ok := structKeysCache.Load(t); ok {
+		return k.(*structKeys)
+	}
+	k := &structKeys{exact: make(map[string]reflect.Type), folded: make(map[string]reflect.Type)}
+	k.add(t, map[reflect.Type]bool{})
+	v, _ := structKeysCache.LoadOrStore(t, k)
+	return v.(*structKeys)
+}
+
+// add collects the fields of t, promoting those of embedded structs without
+// a name in their tag. The first field with a name wins.
+func (k *structKeys) add(t reflect.Type, seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	var embedded []reflect.Type
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		if sf.Anonymous && name == "" {
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if _, ok := k.exact[name]; ok {
+			continue
+		}
+		k.exact[name] = sf.Type
+		if strings.Contains(","+opts+",", ",case:ignore,") {
+			k.folded[name] = sf.Type
+		}
+	}
+	for _, et := range embedded {
+		k.add(et, seen)
+	}
+}
+
+// lookup returns the type of the field key decodes into, and whether key
+// matches a field only case-insensitively and must be dropped.
+func (k *structKeys) lookup(key string) (reflect.Type, bool) {
+	if t, ok := k.exact[key]; ok {
+		return t, false
+	}
+	for name, t := range k.folded {
+		if strings.EqualFold(name, key) {
+			return t, false
+		}
+	}
+	for name := range k.exact {
+		if strings.EqualFold(name, key) {
+			return nil, true
+		}
+	}
+	return nil, false
+}
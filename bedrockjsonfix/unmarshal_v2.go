@@ -0,0 +1,25 @@
+//go:build go1.27
+
+package bedrockjsonfix
+
+import (
+	"encoding/json/jsontext"
+	jsonv2 "encoding/json/v2"
+	"errors"
+)
+
+// decodeJSON decodes strict JSON into v with encoding/json/v2, letting the
+// last of duplicate keys win.
+func decodeJSON(data []byte, v any) error {
+	return jsonv2.Unmarshal(data, v, jsontext.AllowDuplicateNames(true))
+}
+
+// decodeErrorAt returns the JSON Pointer and output offset of the value a
+// decodeJSON error names.
+func decodeErrorAt(err error) (pointer string, offset int64, ok bool) {
+	var se *jsonv2.SemanticError
+	if !errors.As(err, &se) {
+		return "", 0, false
+	}
+	return string(se.JSONPointer), se.ByteOffset, true
+}
@@ -6,3 +6,38 @@ func minInt(a, b int) int {
 	}
 	return b
 }
+
+const hexUpper = "0123456789ABCDEF"
+
+func hasLiteralToken(input []byte, start int, lit string) bool {
+	end := start + len(lit)
+	if end > len(input) {
+		return false
+	}
+	for i := 0; i < len(lit); i++ {
+		if input[start+i] != lit[i] {
+			return false
+		}
+	}
+	if end < len(input) && isAlpha(input[end]) {
+		return false
+	}
+	return true
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\n' || c == '\r' || c == '\t' }
+
+// nonSpaceBytes returns the number of bytes in b that are not JSON whitespace.
+func nonSpaceBytes(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if !isSpace(c) {
+			n++
+		}
+	}
+	return n
+}
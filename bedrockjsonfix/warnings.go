@@ -0,0 +1,85 @@
+package bedrockjsonfix
+
+import "fmt"
+
+// Severity ranks warnings and lint diagnostics by how much they affect the input.
+type Severity int
+
+const (
+	// SeverityInfo marks repairs that only remove noise around the document.
+	SeverityInfo Severity = iota + 1
+	// SeverityWarning marks guesses or repairs that may have altered content.
+	SeverityWarning
+	// SeverityError marks problems that cannot be repaired with the given options.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Stable warning codes reported in Warning.Code.
+const (
+	// WarnCP1252Fallback: input was not valid UTF-8 and was decoded as Windows-1252.
+	WarnCP1252Fallback = "cp1252_fallback"
+	// WarnJunkDropped: bytes that are not JSON tokens were dropped outside strings.
+	WarnJunkDropped = "junk_dropped"
+	// WarnLeadingDataDiscarded: data before the root value was discarded.
+	WarnLeadingDataDiscarded = "leading_data_discarded"
+	// WarnTrailingDataDiscarded: data after the root value was discarded.
+	WarnTrailingDataDiscarded = "trailing_data_discarded"
+	// WarnRootScanUsed: the first root candidate failed and a later one was used.
+	WarnRootScanUsed = "root_scan_used"
+	// WarnNBSPReplacedInStrings: AggressiveWhitespace replaced NBSP inside string values.
+	WarnNBSPReplacedInStrings = "nbsp_replaced_in_strings"
+	// WarnCodeWrapperRemoved: a JavaScript wrapper around the literal was removed.
+	WarnCodeWrapperRemoved = "code_wrapper_removed"
+	// WarnStringJSONUnwrapped: the document was decoded from a JSON string.
+	WarnStringJSONUnwrapped = "string_json_unwrapped"
+	// WarnMarkdownUnwrapped: the document was taken out of a Markdown message.
+	WarnMarkdownUnwrapped = "markdown_unwrapped"
+)
+
+// warningsFromReport derives the warnings of a successful run from its
+// classified report. Data discarded around the root is only reported when
+// it was more than whitespace.
+func warningsFromReport(rep Report) []Warning {
+	var ws []Warning
+	if rep.UsedCP1252Fallback {
+		ws = append(ws, Warning{Code: WarnCP1252Fallback, Severity: SeverityWarning, Message: "input was not valid UTF-8 and was decoded as Windows-1252"})
+	}
+	if rep.DroppedJunkOutsideStrings > 0 {
+		ws = append(ws, Warning{Code: WarnJunkDropped, Severity: SeverityWarning, Message: fmt.Sprintf("dropped %d junk bytes outside strings", rep.DroppedJunkOutsideStrings)})
+	}
+	if rep.RootScanUsed {
+		ws = append(ws, Warning{Code: WarnRootScanUsed, Severity: SeverityWarning, Message: fmt.Sprintf("first root candidate failed; used root scan attempt %d", rep.RootScanAttemptsUsed)})
+	}
+	if rep.Repairs&RepairLeadingJunk != 0 {
+		ws = append(ws, Warning{Code: WarnLeadingDataDiscarded, Severity: SeverityWarning, Message: fmt.Sprintf("discarded %d bytes before the root value", rep.TrimmedLeadingJunkBytes)})
+	}
+	if rep.Repairs&RepairTrailingJunk != 0 {
+		ws = append(ws, Warning{Code: WarnTrailingDataDiscarded, Severity: SeverityWarning, Message: fmt.Sprintf("discarded %d bytes after the root value", rep.TrimmedTrailingJunkBytes)})
+	}
+	if rep.CodeWrapper != "" {
+		ws = append(ws, Warning{Code: WarnCodeWrapperRemoved, Severity: SeverityInfo, Message: "removed " + rep.CodeWrapper + " wrapper around the literal"})
+	}
+	if rep.Markdown != (Span{}) {
+		ws = append(ws, Warning{Code: WarnMarkdownUnwrapped, Severity: SeverityInfo, Message: fmt.Sprintf("used bytes %d to %d of a Markdown message", rep.Markdown.Start, rep.Markdown.End)})
+	}
+	if rep.UnwrappedStringLayers > 0 {
+		ws = append(ws, Warning{Code: WarnStringJSONUnwrapped, Severity: SeverityWarning, Message: fmt.Sprintf("decoded the document from %d layers of JSON string", rep.UnwrappedStringLayers)})
+	}
+	if rep.ReplacedNBSPInStrings > 0 {
+		ws = append(ws, Warning{Code: WarnNBSPReplacedInStrings, Severity: SeverityWarning, Message: fmt.Sprintf("replaced %d non-breaking spaces inside strings", rep.ReplacedNBSPInStrings)})
+	}
+	return ws
+}
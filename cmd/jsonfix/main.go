@@ -10,6 +10,7 @@ import (
 
 func run() error {
 	pretty := flag.Bool("pretty", true, "pretty print output")
+	rulesPath := flag.String("rules", "", "repair rule file to apply")
 	flag.Parse()
 	if flag.NArg() < 1 {
 		return fmt.Errorf("usage: jsonfix <file>")
@@ -20,6 +21,18 @@ func run() error {
 	}
 	opt := bedrockjsonfix.DefaultOptions()
 	opt.Pretty = *pretty
+	if *rulesPath != "" {
+		f, err := os.Open(*rulesPath)
+		if err != nil {
+			return fmt.Errorf("open rules: %w", err)
+		}
+		rules, err := bedrockjsonfix.LoadRules(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("load rules: %w", err)
+		}
+		opt.Stages = append(opt.Stages, rules.StageAt())
+	}
 	res, err := bedrockjsonfix.FixBytes(in, opt)
 	if err != nil {
 		return fmt.Errorf("fix input: %w", err)